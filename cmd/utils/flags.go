@@ -1179,7 +1179,15 @@ func RegisterDashboardService(stack *node.Node, cfg *dashboard.Config, commit st
 // RegisterShhService configures Whisper and adds it to the given node.
 func RegisterShhService(stack *node.Node, cfg *whisper.Config) {
 	if err := stack.Register(func(n *node.ServiceContext) (node.Service, error) {
-		return whisper.New(cfg), nil
+		shh := whisper.New(cfg)
+		scryptN, scryptP, keydir, err := n.GetConfig().AccountConfig()
+		if err != nil {
+			return nil, err
+		}
+		if keydir != "" {
+			shh.SetIdentityStore(filepath.Join(keydir, "whisper"), scryptN, scryptP)
+		}
+		return shh, nil
 	}); err != nil {
 		Fatalf("Failed to register the Whisper service: %v", err)
 	}
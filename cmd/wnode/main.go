@@ -96,6 +96,7 @@ var (
 	argMaxSize   = flag.Uint("maxsize", uint(whisper.DefaultMaxMessageSize), "max size of message")
 	argPoW       = flag.Float64("pow", whisper.DefaultMinimumPoW, "PoW for normal messages in float format (e.g. 2.7)")
 	argServerPoW = flag.Float64("mspow", whisper.DefaultMinimumPoW, "PoW requirement for Mail Server request")
+	argServerReq = flag.Int("msrequests", 0, "authenticate Mail Server requests, allowing each identity this many requests per minute (0 = no authentication)")
 
 	argIP      = flag.String("ip", "", "IP address and port of this node (e.g. 127.0.0.1:30303)")
 	argPub     = flag.String("pub", "", "public key for asymmetric encryption")
@@ -272,6 +273,9 @@ func initialize() {
 	if *mailServerMode {
 		shh.RegisterServer(&mailServer)
 		mailServer.Init(shh, *argDBPath, msPassword, *argServerPoW)
+		if *argServerReq > 0 {
+			mailServer.SetAuthorizer(mailserver.NewRateLimitAuthorizer(*argServerReq, time.Minute))
+		}
 	}
 
 	server = &p2p.Server{
@@ -719,16 +723,21 @@ func requestExpiredMessagesLoop() {
 			timeUpp = 0xFFFFFFFF
 		}
 
-		data := make([]byte, 8, 8+whisper.BloomFilterSize)
+		data := make([]byte, 8, 8+whisper.BloomFilterSize+4)
 		binary.BigEndian.PutUint32(data, timeLow)
 		binary.BigEndian.PutUint32(data[4:], timeUpp)
 		data = append(data, bloom...)
 
+		// the request time allows mail servers to authenticate the request
+		sent := make([]byte, 4)
+		binary.BigEndian.PutUint32(sent, uint32(time.Now().Unix()))
+		data = append(data, sent...)
+
 		var params whisper.MessageParams
 		params.PoW = *argServerPoW
 		params.Payload = data
 		params.KeySym = key
-		params.Src = asymKey
+		params.Src = nodeid // mail servers authenticating the requests expect them signed by the requesting node
 		params.WorkTime = 5
 
 		msg, err := whisper.NewSentMessage(&params)
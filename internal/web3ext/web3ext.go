@@ -619,6 +619,10 @@ web3._extend({
 			name: 'info',
 			getter: 'shh_info'
 		}),
+		new web3._extend.Property({
+			name: 'droppedEnvelopes',
+			getter: 'shh_droppedEnvelopes'
+		}),
 	]
 });
 `
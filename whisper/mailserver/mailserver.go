@@ -17,8 +17,12 @@
 package mailserver
 
 import (
+	"bytes"
+	"crypto/ecdsa"
 	"encoding/binary"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
@@ -30,11 +34,23 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// requestTimeAllowance is the maximum difference in seconds between the time a
+// request was signed and the time it is processed, when requests are authenticated.
+const requestTimeAllowance = 60
+
+// RequestAuthorizer decides whether the identity which signed a mail request
+// is allowed to retrieve the messages archived within the requested time range.
+// Implementations must be safe for concurrent use.
+type RequestAuthorizer interface {
+	Authorize(identity *ecdsa.PublicKey, lower, upper uint32) bool
+}
+
 type WMailServer struct {
-	db  *leveldb.DB
-	w   *whisper.Whisper
-	pow float64
-	key []byte
+	db   *leveldb.DB
+	w    *whisper.Whisper
+	pow  float64
+	key  []byte
+	auth RequestAuthorizer
 }
 
 type DBKey struct {
@@ -82,6 +98,13 @@ func (s *WMailServer) Init(shh *whisper.Whisper, path string, password string, p
 	}
 }
 
+// SetAuthorizer enables the authentication of the mail requests. Once set, only
+// signed requests carrying a recent request time are served, and only if the
+// authorizer accepts the identity of the signer for the requested time range.
+func (s *WMailServer) SetAuthorizer(auth RequestAuthorizer) {
+	s.auth = auth
+}
+
 func (s *WMailServer) Close() {
 	if s.db != nil {
 		s.db.Close()
@@ -191,5 +214,83 @@ func (s *WMailServer) validateRequest(peerID []byte, request *whisper.Envelope)
 
 	lower := binary.BigEndian.Uint32(decrypted.Payload[:4])
 	upper := binary.BigEndian.Uint32(decrypted.Payload[4:8])
+
+	if s.auth != nil && !s.authenticateRequest(peerID, src, decrypted, lower, upper) {
+		return false, 0, 0, nil
+	}
 	return true, lower, upper, bloom
 }
+
+// authenticateRequest checks that the request was signed by the peer which
+// sent it, so that it can't be relayed by somebody else, that it was signed
+// recently, so that it can't be replayed later, and that the signer is
+// authorized to retrieve the requested time range. The time of the request is
+// expected in the four bytes following the bloom filter.
+func (s *WMailServer) authenticateRequest(peerID, src []byte, request *whisper.ReceivedMessage, lower, upper uint32) bool {
+	if !bytes.Equal(peerID, src) {
+		log.Warn(fmt.Sprintf("Foreign p2p request from peer %x", peerID))
+		return false
+	}
+	if len(request.Payload) < 8+whisper.BloomFilterSize+4 {
+		log.Warn("Missing request time in p2p request")
+		return false
+	}
+	sent := int64(binary.BigEndian.Uint32(request.Payload[8+whisper.BloomFilterSize:]))
+	if diff := time.Now().Unix() - sent; diff > requestTimeAllowance || diff < -requestTimeAllowance {
+		log.Warn(fmt.Sprintf("Stale p2p request, sent at %d", sent))
+		return false
+	}
+	if !s.auth.Authorize(request.Src, lower, upper) {
+		log.Warn(fmt.Sprintf("Unauthorized p2p request from %x", crypto.FromECDSAPub(request.Src)))
+		return false
+	}
+	return true
+}
+
+// RateLimitAuthorizer is a RequestAuthorizer allowing every identity a limited
+// number of requests within a period of time.
+type RateLimitAuthorizer struct {
+	limit  int
+	period time.Duration
+
+	mu       sync.Mutex
+	requests map[string][]time.Time // times of the recent requests of every identity
+}
+
+// NewRateLimitAuthorizer creates an authorizer allowing each identity up to
+// limit requests within the given period.
+func NewRateLimitAuthorizer(limit int, period time.Duration) *RateLimitAuthorizer {
+	return &RateLimitAuthorizer{
+		limit:    limit,
+		period:   period,
+		requests: make(map[string][]time.Time),
+	}
+}
+
+// Authorize implements RequestAuthorizer.
+func (a *RateLimitAuthorizer) Authorize(identity *ecdsa.PublicKey, lower, upper uint32) bool {
+	key := string(crypto.FromECDSAPub(identity))
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// forget the requests which fell out of the period, and
+	// the identities which didn't send any request within it
+	for id, times := range a.requests {
+		for len(times) > 0 && now.Sub(times[0]) >= a.period {
+			times = times[1:]
+		}
+		if len(times) == 0 {
+			delete(a.requests, id)
+		} else {
+			a.requests[id] = times
+		}
+	}
+
+	if len(a.requests[key]) >= a.limit {
+		return false
+	}
+	a.requests[key] = append(a.requests[key], now)
+	return true
+}
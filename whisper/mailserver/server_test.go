@@ -27,6 +27,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
 	whisper "github.com/ethereum/go-ethereum/whisper/whisperv6"
 )
 
@@ -41,6 +42,7 @@ type ServerTestParams struct {
 	low   uint32
 	upp   uint32
 	key   *ecdsa.PrivateKey
+	sent  uint32 // request time, omitted from the request if zero
 }
 
 func assert(statement bool, text string, t *testing.T) {
@@ -106,6 +108,76 @@ func TestMailServer(t *testing.T) {
 	deliverTest(t, &server, env)
 }
 
+func TestMailServerAuthentication(t *testing.T) {
+	const password = "password_for_this_test"
+	const dbPath = "whisper-server-auth-test"
+
+	dir, err := ioutil.TempDir("", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var server WMailServer
+	shh = whisper.New(&whisper.DefaultConfig)
+	shh.RegisterServer(&server)
+
+	server.Init(shh, dir, password, powRequirement)
+	defer server.Close()
+	server.SetAuthorizer(NewRateLimitAuthorizer(1, time.Minute))
+
+	keyID, err = shh.AddSymKeyFromPassword(password)
+	if err != nil {
+		t.Fatalf("Failed to create symmetric key for mail request: %s", err)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate new key pair with seed %d: %s.", seed, err)
+	}
+	p := &ServerTestParams{
+		topic: whisper.TopicType{0x1F, 0x7E, 0xA1, 0x7F},
+		low:   1,
+		upp:   0xffffffff,
+		key:   key,
+	}
+	src := crypto.FromECDSAPub(&key.PublicKey)
+
+	ok, _, _, _ := server.validateRequest(src, createRequest(t, p))
+	assert(!ok, "request without request time accepted", t)
+
+	p.sent = uint32(time.Now().Unix()) - 2*requestTimeAllowance
+	ok, _, _, _ = server.validateRequest(src, createRequest(t, p))
+	assert(!ok, "stale request accepted", t)
+
+	p.sent = uint32(time.Now().Unix())
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate new key pair with seed %d: %s.", seed, err)
+	}
+	ok, _, _, _ = server.validateRequest(crypto.FromECDSAPub(&other.PublicKey), createRequest(t, p))
+	assert(!ok, "request relayed by another peer accepted", t)
+
+	ok, _, _, _ = server.validateRequest(src, createRequest(t, p))
+	assert(ok, "authenticated request rejected", t)
+
+	ok, _, _, _ = server.validateRequest(src, createRequest(t, p))
+	assert(!ok, "request beyond the rate limit accepted", t)
+
+	// wnode signs its requests with the key of the node, whose ID the
+	// requesting peer is known by
+	nodeKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate new key pair with seed %d: %s.", seed, err)
+	}
+	peerID := discover.PubkeyID(&nodeKey.PublicKey)
+	p.key = nodeKey
+	ok, _, _, _ = server.validateRequest(peerID[:], createRequest(t, p))
+	assert(ok, "request signed by the node key rejected", t)
+
+	p.key = other
+	ok, _, _, _ = server.validateRequest(peerID[:], createRequest(t, p))
+	assert(!ok, "request signed by a key other than the node key accepted", t)
+}
+
 func deliverTest(t *testing.T, server *WMailServer, env *whisper.Envelope) {
 	id, err := shh.NewKeyPair()
 	if err != nil {
@@ -182,6 +254,11 @@ func createRequest(t *testing.T, p *ServerTestParams) *whisper.Envelope {
 	binary.BigEndian.PutUint32(data, p.low)
 	binary.BigEndian.PutUint32(data[4:], p.upp)
 	data = append(data, bloom...)
+	if p.sent != 0 {
+		sent := make([]byte, 4)
+		binary.BigEndian.PutUint32(sent, p.sent)
+		data = append(data, sent...)
+	}
 
 	key, err := shh.GetSymKey(keyID)
 	if err != nil {
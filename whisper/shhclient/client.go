@@ -58,6 +58,14 @@ func (sc *Client) Info(ctx context.Context) (whisper.Info, error) {
 	return info, err
 }
 
+// DroppedEnvelopes returns the number of envelopes recently dropped by the node,
+// broken down by the reason of rejection.
+func (sc *Client) DroppedEnvelopes(ctx context.Context) (whisper.DropStats, error) {
+	var stats whisper.DropStats
+	err := sc.c.CallContext(ctx, &stats, "shh_droppedEnvelopes")
+	return stats, err
+}
+
 // SetMaxMessageSize sets the maximal message size allowed by this node. Incoming
 // and outgoing messages with a larger size will be rejected. Whisper message size
 // can never exceed the limit imposed by the underlying P2P protocol (10 Mb).
@@ -77,6 +85,19 @@ func (sc *Client) SetMinimumPoW(ctx context.Context, pow float64) error {
 	return sc.c.CallContext(ctx, &ignored, "shh_setMinPoW", pow)
 }
 
+// SetTopicPoW sets the minimal PoW required by this node for envelopes with the
+// given topic, overriding the general minimum for that topic.
+func (sc *Client) SetTopicPoW(ctx context.Context, topic whisper.TopicType, pow float64) error {
+	var ignored bool
+	return sc.c.CallContext(ctx, &ignored, "shh_setTopicPoW", topic, pow)
+}
+
+// RemoveTopicPoW restores the general minimal PoW for the given topic.
+func (sc *Client) RemoveTopicPoW(ctx context.Context, topic whisper.TopicType) error {
+	var ignored bool
+	return sc.c.CallContext(ctx, &ignored, "shh_removeTopicPoW", topic)
+}
+
 // Marks specific peer trusted, which will allow it to send historic (expired) messages.
 // Note This function is not adding new nodes, the node needs to exists as a peer.
 func (sc *Client) MarkTrustedPeer(ctx context.Context, enode string) error {
@@ -103,6 +124,33 @@ func (sc *Client) DeleteKeyPair(ctx context.Context, id string) (string, error)
 	return id, sc.c.CallContext(ctx, &ignored, "shh_deleteKeyPair", id)
 }
 
+// PersistKeyPair stores the key pair with the given ID in the node's keystore
+// directory, encrypted with the passphrase. The key pairs are managed by a
+// private API, which is only available over the IPC endpoint by default.
+func (sc *Client) PersistKeyPair(ctx context.Context, id string, passphrase string) error {
+	var ignored bool
+	return sc.c.CallContext(ctx, &ignored, "shhkeystore_persistKeyPair", id, passphrase)
+}
+
+// UnlockKeyPair decrypts the persisted key pair with the given ID, making it
+// available to the node under the same ID.
+func (sc *Client) UnlockKeyPair(ctx context.Context, id string, passphrase string) error {
+	var ignored bool
+	return sc.c.CallContext(ctx, &ignored, "shhkeystore_unlockKeyPair", id, passphrase)
+}
+
+// DeletePersistedKeyPair removes the persisted key pair with the given ID.
+func (sc *Client) DeletePersistedKeyPair(ctx context.Context, id string, passphrase string) error {
+	var ignored bool
+	return sc.c.CallContext(ctx, &ignored, "shhkeystore_deletePersistedKeyPair", id, passphrase)
+}
+
+// ListPersistedKeyPairs returns the IDs of the persisted key pairs.
+func (sc *Client) ListPersistedKeyPairs(ctx context.Context) ([]string, error) {
+	var ids []string
+	return ids, sc.c.CallContext(ctx, &ids, "shhkeystore_listPersistedKeyPairs")
+}
+
 // HasKeyPair returns an indication if the node has a private key or
 // key pair matching the given ID.
 func (sc *Client) HasKeyPair(ctx context.Context, id string) (bool, error) {
@@ -165,6 +213,28 @@ func (sc *Client) Post(ctx context.Context, message whisper.NewMessage) error {
 	return sc.c.CallContext(ctx, &ignored, "shh_post", message)
 }
 
+// SealEnvelope requests the node to perform the proof of work of the envelope
+// on behalf of the caller, and updates the envelope with the result. The
+// contents of the envelope are not revealed, as they are already encrypted.
+// This method is only supported on bi-directional connections such as
+// websockets and IPC.
+func (sc *Client) SealEnvelope(ctx context.Context, env *whisper.Envelope, powTime uint32, powTarget float64) error {
+	req := whisper.SealRequest{
+		Expiry:    env.Expiry,
+		TTL:       env.TTL,
+		Topic:     env.Topic,
+		Data:      env.Data,
+		PowTime:   powTime,
+		PowTarget: powTarget,
+	}
+	var sealed whisper.SealedEnvelope
+	if err := sc.c.CallContext(ctx, &sealed, "shh_sealEnvelope", req); err != nil {
+		return err
+	}
+	env.Expiry, env.Nonce = sealed.Expiry, uint64(sealed.Nonce)
+	return nil
+}
+
 // SubscribeMessages subscribes to messages that match the given criteria. This method
 // is only supported on bi-directional connections such as websockets and IPC.
 // NewMessageFilter uses polling and is supported over HTTP.
@@ -192,3 +262,9 @@ func (sc *Client) FilterMessages(ctx context.Context, id string) ([]*whisper.Mes
 	var messages []*whisper.Message
 	return messages, sc.c.CallContext(ctx, &messages, "shh_getFilterMessages", id)
 }
+
+// FilterStats retrieves the delivery statistics of the filter with the given id.
+func (sc *Client) FilterStats(ctx context.Context, id string) (whisper.FilterStats, error) {
+	var stats whisper.FilterStats
+	return stats, sc.c.CallContext(ctx, &stats, "shh_getFilterStats", id)
+}
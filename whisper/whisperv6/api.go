@@ -18,7 +18,6 @@ package whisperv6
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"sync"
@@ -44,6 +43,9 @@ var (
 	ErrInvalidSigningPubKey = errors.New("invalid signing public key")
 	ErrTooLowPoW            = errors.New("message rejected, PoW too low")
 	ErrNoTopics             = errors.New("missing topic(s)")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrReorderWindow        = fmt.Errorf("reorder window exceeds %d seconds", DefaultTTL)
+	ErrSealConnection       = errors.New("envelope sealing is only available over persistent connections")
 )
 
 // PublicWhisperAPI provides the whisper RPC service that can be
@@ -51,15 +53,17 @@ var (
 type PublicWhisperAPI struct {
 	w *Whisper
 
-	mu       sync.Mutex
-	lastUsed map[string]time.Time // keeps track when a filter was polled for the last time.
+	mu          sync.Mutex
+	lastUsed    map[string]time.Time                // keeps track when a filter was polled for the last time.
+	multiplexed map[rpc.ID]*multiplexedSubscription // filters of the active multiplexed subscriptions
 }
 
 // NewPublicWhisperAPI create a new RPC whisper service.
 func NewPublicWhisperAPI(w *Whisper) *PublicWhisperAPI {
 	api := &PublicWhisperAPI{
-		w:        w,
-		lastUsed: make(map[string]time.Time),
+		w:           w,
+		lastUsed:    make(map[string]time.Time),
+		multiplexed: make(map[rpc.ID]*multiplexedSubscription),
 	}
 	return api
 }
@@ -75,6 +79,10 @@ type Info struct {
 	Messages       int     `json:"messages"`       // Number of floating messages.
 	MinPow         float64 `json:"minPow"`         // Minimal accepted PoW
 	MaxMessageSize uint32  `json:"maxMessageSize"` // Maximum accepted message size
+	Cached         int     `json:"cached"`         // Number of envelopes in the cache of already seen envelopes.
+	CacheSize      int     `json:"cacheSize"`      // Maximum size of the envelope cache in bytes.
+	CacheEvictions int     `json:"cacheEvictions"` // Number of envelopes evicted from the cache before their expiry.
+	QueueDepths    []int   `json:"queueDepths"`    // Number of messages waiting in each of the message queue shards.
 }
 
 // Info returns diagnostic information about the whisper node.
@@ -82,9 +90,36 @@ func (api *PublicWhisperAPI) Info(ctx context.Context) Info {
 	stats := api.w.Stats()
 	return Info{
 		Memory:         stats.memoryUsed,
-		Messages:       len(api.w.messageQueue) + len(api.w.p2pMsgQueue),
+		Messages:       api.w.queuedMessages() + len(api.w.priorityMsgQueue) + len(api.w.p2pMsgQueue),
 		MinPow:         api.w.MinPow(),
 		MaxMessageSize: api.w.MaxMessageSize(),
+		Cached:         api.w.CachedEnvelopes(),
+		CacheSize:      api.w.cacheSize,
+		CacheEvictions: stats.evictions,
+		QueueDepths:    api.w.QueueDepths(),
+	}
+}
+
+// DropStats contains the number of incoming envelopes dropped for each reason
+// over a rolling window of time.
+type DropStats struct {
+	Window        uint32 `json:"window"`        // Length of the window in seconds.
+	LowPoW        uint64 `json:"lowPoW"`        // Envelopes below the minimal accepted PoW.
+	Expired       uint64 `json:"expired"`       // Envelopes received after their expiry.
+	Oversize      uint64 `json:"oversize"`      // Envelopes exceeding the maximum message size.
+	BloomMismatch uint64 `json:"bloomMismatch"` // Envelopes not matching the advertised bloom filter.
+}
+
+// DroppedEnvelopes returns the number of envelopes dropped by the node over
+// the last few minutes, broken down by the reason of rejection.
+func (api *PublicWhisperAPI) DroppedEnvelopes(ctx context.Context) DropStats {
+	counts := api.w.DroppedEnvelopes()
+	return DropStats{
+		Window:        uint32(dropWindow / time.Second),
+		LowPoW:        counts[dropLowPoW],
+		Expired:       counts[dropExpired],
+		Oversize:      counts[dropOversize],
+		BloomMismatch: counts[dropBloomMismatch],
 	}
 }
 
@@ -99,6 +134,19 @@ func (api *PublicWhisperAPI) SetMinPoW(ctx context.Context, pow float64) (bool,
 	return true, api.w.SetMinimumPoW(pow)
 }
 
+// SetTopicPoW sets the minimum PoW for the given topic, overriding the general
+// minimum, and notifies the peers.
+func (api *PublicWhisperAPI) SetTopicPoW(ctx context.Context, topic TopicType, pow float64) (bool, error) {
+	return true, api.w.SetTopicPoW(topic, pow)
+}
+
+// RemoveTopicPoW restores the general minimum PoW for the given topic, and
+// notifies the peers.
+func (api *PublicWhisperAPI) RemoveTopicPoW(ctx context.Context, topic TopicType) bool {
+	api.w.RemoveTopicPoW(topic)
+	return true
+}
+
 // SetBloomFilter sets the new value of bloom filter, and notifies the peers.
 func (api *PublicWhisperAPI) SetBloomFilter(ctx context.Context, bloom hexutil.Bytes) (bool, error) {
 	return true, api.w.SetBloomFilter(bloom)
@@ -117,6 +165,9 @@ func (api *PublicWhisperAPI) MarkTrustedPeer(ctx context.Context, enode string)
 // NewKeyPair generates a new public and private key pair for message decryption and encryption.
 // It returns an ID that can be used to refer to the keypair.
 func (api *PublicWhisperAPI) NewKeyPair(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	return api.w.NewKeyPair()
 }
 
@@ -166,6 +217,9 @@ func (api *PublicWhisperAPI) GetPrivateKey(ctx context.Context, id string) (hexu
 // It returns an ID that can be used to refer to the key.
 // Can be used encrypting and decrypting messages where the key is known to both parties.
 func (api *PublicWhisperAPI) NewSymKey(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	return api.w.GenerateSymKey()
 }
 
@@ -177,8 +231,19 @@ func (api *PublicWhisperAPI) AddSymKey(ctx context.Context, key hexutil.Bytes) (
 }
 
 // GenerateSymKeyFromPassword derive a key from the given password, stores it, and returns its ID.
+// The derivation is abandoned and no key is stored if the context is canceled first.
 func (api *PublicWhisperAPI) GenerateSymKeyFromPassword(ctx context.Context, passwd string) (string, error) {
-	return api.w.AddSymKeyFromPassword(passwd)
+	derived := make(chan []byte, 1)
+	go func() {
+		derived <- deriveKeyFromPassword(passwd)
+	}()
+
+	select {
+	case key := <-derived:
+		return api.w.AddSymKeyDirect(key)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
 }
 
 // HasSymKey returns an indication if the node has a symmetric key associated with the given key.
@@ -243,6 +308,9 @@ func (api *PublicWhisperAPI) Post(ctx context.Context, req NewMessage) (bool, er
 	if (symKeyGiven && pubKeyGiven) || (!symKeyGiven && !pubKeyGiven) {
 		return false, ErrSymAsym
 	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 
 	params := &MessageParams{
 		TTL:      req.TTL,
@@ -287,7 +355,7 @@ func (api *PublicWhisperAPI) Post(ctx context.Context, req NewMessage) (bool, er
 		return false, err
 	}
 
-	env, err := whisperMsg.Wrap(params)
+	env, err := whisperMsg.WrapContext(ctx, params)
 	if err != nil {
 		return false, err
 	}
@@ -302,23 +370,69 @@ func (api *PublicWhisperAPI) Post(ctx context.Context, req NewMessage) (bool, er
 	}
 
 	// ensure that the message PoW meets the node's minimum accepted PoW
-	if req.PowTarget < api.w.MinPow() {
+	if req.PowTarget < api.w.MinPowForTopic(req.Topic) {
 		return false, ErrTooLowPoW
 	}
 
 	return true, api.w.Send(env)
 }
 
+// SealRequest is an envelope whose proof of work is requested from the node
+// on behalf of a constrained client.
+type SealRequest struct {
+	Expiry    uint32        `json:"expiry"`
+	TTL       uint32        `json:"ttl"`
+	Topic     TopicType     `json:"topic"`
+	Data      hexutil.Bytes `json:"data"`
+	PowTime   uint32        `json:"powTime"`
+	PowTarget float64       `json:"powTarget"`
+}
+
+// SealedEnvelope holds the result of the proof of work of an envelope.
+type SealedEnvelope struct {
+	Expiry uint32         `json:"expiry"`
+	Nonce  hexutil.Uint64 `json:"nonce"`
+	PoW    float64        `json:"pow"`
+}
+
+// SealEnvelope performs the proof of work of an envelope on behalf of the
+// caller. The envelope contents are already encrypted, only the nonce is
+// searched for. The rate limit of the sealing applies per connection, so it
+// is not offered over HTTP, where each call is a connection of its own.
+func (api *PublicWhisperAPI) SealEnvelope(ctx context.Context, req SealRequest) (*SealedEnvelope, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrSealConnection
+	}
+	env := &Envelope{
+		Expiry: req.Expiry,
+		TTL:    req.TTL,
+		Topic:  req.Topic,
+		Data:   req.Data,
+	}
+	params := &MessageParams{
+		TTL:      req.TTL,
+		PoW:      req.PowTarget,
+		WorkTime: req.PowTime,
+	}
+	if err := api.w.SealEnvelope(ctx, notifier, env, params); err != nil {
+		return nil, err
+	}
+	return &SealedEnvelope{Expiry: env.Expiry, Nonce: hexutil.Uint64(env.Nonce), PoW: env.PoW()}, nil
+}
+
 //go:generate gencodec -type Criteria -field-override criteriaOverride -out gen_criteria_json.go
 
 // Criteria holds various filter options for inbound messages.
 type Criteria struct {
-	SymKeyID     string      `json:"symKeyID"`
-	PrivateKeyID string      `json:"privateKeyID"`
-	Sig          []byte      `json:"sig"`
-	MinPow       float64     `json:"minPow"`
-	Topics       []TopicType `json:"topics"`
-	AllowP2P     bool        `json:"allowP2P"`
+	SymKeyID      string      `json:"symKeyID"`
+	PrivateKeyID  string      `json:"privateKeyID"`
+	Sig           []byte      `json:"sig"`
+	MinPow        float64     `json:"minPow"`
+	Topics        []TopicType `json:"topics"`
+	AllowP2P      bool        `json:"allowP2P"`
+	ReorderWindow uint32      `json:"reorderWindow"` // seconds to buffer messages for, delivering them in Sent order, at most DefaultTTL
+	ContentTypes  []string    `json:"contentTypes"`  // content types of framed payloads to deliver, any if empty
 }
 
 type criteriaOverride struct {
@@ -328,27 +442,73 @@ type criteriaOverride struct {
 // Messages set up a subscription that fires events when messages arrive that match
 // the given set of criteria.
 func (api *PublicWhisperAPI) Messages(ctx context.Context, crit Criteria) (*rpc.Subscription, error) {
-	var (
-		symKeyGiven = len(crit.SymKeyID) > 0
-		pubKeyGiven = len(crit.PrivateKeyID) > 0
-		err         error
-	)
-
 	// ensure that the RPC connection supports subscriptions
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return nil, rpc.ErrNotificationsUnsupported
 	}
 
+	filter, err := api.subscriptionFilter(crit)
+	if err != nil {
+		return nil, err
+	}
+
+	// the filter setup may have taken a while, don't install it for a gone caller
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	id, err := api.w.Subscribe(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// create subscription and start waiting for message events
+	rpcSub := notifier.CreateSubscription()
+	sub := &multiplexedSubscription{notifier: notifier, filters: map[string]struct{}{id: {}}}
+	go api.serveSubscription(rpcSub, sub, false)
+
+	return rpcSub, nil
+}
+
+// subscriptionFilter creates the message filter of a subscription for the given
+// set of criteria. Unlike the polled filters, the subscriptions decrypting with
+// a symmetric key must specify their topics.
+func (api *PublicWhisperAPI) subscriptionFilter(crit Criteria) (*Filter, error) {
+	filter, err := api.criteriaFilter(crit)
+	if err != nil {
+		return nil, err
+	}
+	if filter.KeySym != nil && len(filter.Topics) == 0 {
+		return nil, ErrNoTopics
+	}
+	return filter, nil
+}
+
+// criteriaFilter creates the message filter for the given set of criteria.
+func (api *PublicWhisperAPI) criteriaFilter(crit Criteria) (*Filter, error) {
+	var (
+		symKeyGiven = len(crit.SymKeyID) > 0
+		pubKeyGiven = len(crit.PrivateKeyID) > 0
+		err         error
+	)
+
 	// user must specify either a symmetric or an asymmetric key
 	if (symKeyGiven && pubKeyGiven) || (!symKeyGiven && !pubKeyGiven) {
 		return nil, ErrSymAsym
 	}
 
+	// messages are held back in memory for the reorder window
+	if crit.ReorderWindow > DefaultTTL {
+		return nil, ErrReorderWindow
+	}
+
 	filter := Filter{
-		PoW:      crit.MinPow,
-		Messages: make(map[common.Hash]*ReceivedMessage),
-		AllowP2P: crit.AllowP2P,
+		PoW:           crit.MinPow,
+		Messages:      make(map[common.Hash]*ReceivedMessage),
+		AllowP2P:      crit.AllowP2P,
+		ReorderWindow: time.Duration(crit.ReorderWindow) * time.Second,
+		ContentTypes:  crit.ContentTypes,
 	}
 
 	if len(crit.Sig) > 0 {
@@ -362,14 +522,13 @@ func (api *PublicWhisperAPI) Messages(ctx context.Context, crit Criteria) (*rpc.
 		if len(bt) == 0 || len(bt) > 4 {
 			return nil, fmt.Errorf("subscribe: topic %d has wrong size: %d", i, len(bt))
 		}
-		filter.Topics = append(filter.Topics, bt[:])
+		topic := make([]byte, TopicLength)
+		copy(topic, bt[:])
+		filter.Topics = append(filter.Topics, topic)
 	}
 
 	// listen for message that are encrypted with the given symmetric key
 	if symKeyGiven {
-		if len(filter.Topics) == 0 {
-			return nil, ErrNoTopics
-		}
 		key, err := api.w.GetSymKey(crit.SymKeyID)
 		if err != nil {
 			return nil, err
@@ -389,39 +548,238 @@ func (api *PublicWhisperAPI) Messages(ctx context.Context, crit Criteria) (*rpc.
 		}
 	}
 
-	id, err := api.w.Subscribe(&filter)
-	if err != nil {
+	return &filter, nil
+}
+
+// MultiplexedMessage is the notification of a multiplexed subscription. It
+// carries the message along with the ID of the criteria it matched.
+type MultiplexedMessage struct {
+	Criteria string   `json:"criteria"`
+	Message  *Message `json:"message"`
+}
+
+// multiplexedSubscription tracks the filters installed for the criteria
+// carried by a single subscription.
+type multiplexedSubscription struct {
+	notifier *rpc.Notifier // Notifier of the connection which created the subscription
+
+	mu      sync.Mutex
+	filters map[string]struct{} // IDs of the installed filters, nil once the subscription ended
+}
+
+// MultiplexedMessages sets up a single subscription that fires events when
+// messages arrive that match any of the given sets of criteria. Further
+// criteria can be added and removed while the subscription is active, see
+// AddSubscriptionCriteria and RemoveSubscriptionCriteria.
+func (api *PublicWhisperAPI) MultiplexedMessages(ctx context.Context, crits []Criteria) (*rpc.Subscription, error) {
+	// ensure that the RPC connection supports subscriptions
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+
+	filters := make([]*Filter, len(crits))
+	for i, crit := range crits {
+		filter, err := api.subscriptionFilter(crit)
+		if err != nil {
+			return nil, fmt.Errorf("criteria %d: %v", i, err)
+		}
+		filters[i] = filter
+	}
+
+	// the filter setup may have taken a while, don't install it for a gone caller
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	// create subscription and start waiting for message events
+	mux := &multiplexedSubscription{notifier: notifier, filters: make(map[string]struct{})}
+	for _, filter := range filters {
+		id, err := api.w.Subscribe(filter)
+		if err != nil {
+			for id := range mux.filters {
+				api.w.Unsubscribe(id)
+			}
+			return nil, err
+		}
+		mux.filters[id] = struct{}{}
+	}
+
 	rpcSub := notifier.CreateSubscription()
-	go func() {
-		// for now poll internally, refactor whisper internal for channel support
-		ticker := time.NewTicker(250 * time.Millisecond)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				if filter := api.w.GetFilter(id); filter != nil {
-					for _, rpcMessage := range toMessage(filter.Retrieve()) {
-						if err := notifier.Notify(rpcSub.ID, rpcMessage); err != nil {
-							log.Error("Failed to send notification", "err", err)
-						}
+	api.mu.Lock()
+	api.multiplexed[rpcSub.ID] = mux
+	api.mu.Unlock()
+
+	go api.serveSubscription(rpcSub, mux, true)
+
+	return rpcSub, nil
+}
+
+// serveSubscription polls the filters of a subscription and sends the retrieved
+// messages to the subscriber, until the subscription ends. If tagged is set, the
+// messages are sent as MultiplexedMessage notifications, carrying the ID of the
+// filter which matched them.
+func (api *PublicWhisperAPI) serveSubscription(rpcSub *rpc.Subscription, sub *multiplexedSubscription, tagged bool) {
+	// for now poll internally, refactor whisper internal for channel support
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sub.mu.Lock()
+			ids := make([]string, 0, len(sub.filters))
+			for id := range sub.filters {
+				ids = append(ids, id)
+			}
+			sub.mu.Unlock()
+
+			for _, id := range ids {
+				filter := api.w.GetFilter(id)
+				if filter == nil {
+					continue
+				}
+				for _, rpcMessage := range toMessage(filter.Retrieve()) {
+					var notification interface{} = rpcMessage
+					if tagged {
+						notification = &MultiplexedMessage{Criteria: id, Message: rpcMessage}
+					}
+					if err := sub.notifier.Notify(rpcSub.ID, notification); err != nil {
+						log.Error("Failed to send notification", "err", err)
 					}
 				}
-			case <-rpcSub.Err():
-				api.w.Unsubscribe(id)
-				return
-			case <-notifier.Closed():
-				api.w.Unsubscribe(id)
-				return
 			}
+		case <-rpcSub.Err():
+			api.endSubscription(rpcSub.ID, sub)
+			return
+		case <-sub.notifier.Closed():
+			api.endSubscription(rpcSub.ID, sub)
+			return
 		}
-	}()
+	}
+}
 
-	return rpcSub, nil
+// endSubscription uninstalls all the filters of a subscription.
+func (api *PublicWhisperAPI) endSubscription(id rpc.ID, sub *multiplexedSubscription) {
+	api.mu.Lock()
+	delete(api.multiplexed, id)
+	api.mu.Unlock()
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	for id := range sub.filters {
+		api.w.Unsubscribe(id)
+	}
+	sub.filters = nil
+}
+
+// getMultiplexed returns the active multiplexed subscription with the given ID,
+// provided it was created over the same connection as the one in ctx. Other
+// connections, and those not supporting subscriptions, can't control it.
+func (api *PublicWhisperAPI) getMultiplexed(ctx context.Context, id rpc.ID) (*multiplexedSubscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	mux, ok := api.multiplexed[id]
+	if !ok || mux.notifier != notifier {
+		return nil, ErrSubscriptionNotFound
+	}
+	return mux, nil
+}
+
+// AddSubscriptionCriteria adds a set of criteria to the multiplexed
+// subscription with the given ID, created over the same connection. It
+// returns the ID of the criteria, which tags the messages matching them.
+func (api *PublicWhisperAPI) AddSubscriptionCriteria(ctx context.Context, id rpc.ID, crit Criteria) (string, error) {
+	mux, err := api.getMultiplexed(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	filter, err := api.subscriptionFilter(crit)
+	if err != nil {
+		return "", err
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.filters == nil {
+		return "", ErrSubscriptionNotFound
+	}
+	critID, err := api.w.Subscribe(filter)
+	if err != nil {
+		return "", err
+	}
+	mux.filters[critID] = struct{}{}
+	return critID, nil
+}
+
+// RemoveSubscriptionCriteria removes a set of criteria, previously added to
+// the multiplexed subscription with the given ID, created over the same
+// connection.
+func (api *PublicWhisperAPI) RemoveSubscriptionCriteria(ctx context.Context, id rpc.ID, critID string) (bool, error) {
+	mux, err := api.getMultiplexed(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if _, ok := mux.filters[critID]; !ok {
+		return false, fmt.Errorf("criteria %s not found", critID)
+	}
+	delete(mux.filters, critID)
+	if err := api.w.Unsubscribe(critID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PrivateKeystoreAPI provides the whisper RPC service managing the key pairs
+// persisted in the node's keystore directory. It handles passphrases and is
+// therefore not exposed publicly, like the personal API of the accounts.
+type PrivateKeystoreAPI struct {
+	w *Whisper
+}
+
+// NewPrivateKeystoreAPI creates a new RPC service managing the persisted key pairs.
+func NewPrivateKeystoreAPI(w *Whisper) *PrivateKeystoreAPI {
+	return &PrivateKeystoreAPI{w: w}
+}
+
+// PersistKeyPair stores the key pair with the given id in the node's keystore
+// directory, encrypted with the passphrase.
+func (api *PrivateKeystoreAPI) PersistKeyPair(ctx context.Context, id string, passphrase string) (bool, error) {
+	if err := api.w.PersistKeyPair(id, passphrase); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnlockKeyPair decrypts the persisted key pair with the given id, making it
+// available to the node under the same id.
+func (api *PrivateKeystoreAPI) UnlockKeyPair(ctx context.Context, id string, passphrase string) (bool, error) {
+	if err := api.w.UnlockKeyPair(id, passphrase); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeletePersistedKeyPair removes the persisted key pair with the given id
+// from the keystore directory.
+func (api *PrivateKeystoreAPI) DeletePersistedKeyPair(ctx context.Context, id string, passphrase string) (bool, error) {
+	if err := api.w.DeletePersistedKeyPair(id, passphrase); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ListPersistedKeyPairs returns the ids of the persisted key pairs.
+func (api *PrivateKeystoreAPI) ListPersistedKeyPairs(ctx context.Context) ([]string, error) {
+	return api.w.PersistedKeyPairs()
 }
 
 //go:generate gencodec -type Message -field-override messageOverride -out gen_message_json.go
@@ -437,6 +795,8 @@ type Message struct {
 	PoW       float64   `json:"pow"`
 	Hash      []byte    `json:"hash"`
 	Dst       []byte    `json:"recipientPublicKey,omitempty"`
+
+	ContentType string `json:"contentType,omitempty"` // content type of a framed payload
 }
 
 type messageOverride struct {
@@ -457,6 +817,8 @@ func ToWhisperMessage(message *ReceivedMessage) *Message {
 		PoW:       message.PoW,
 		Hash:      message.EnvelopeHash.Bytes(),
 		Topic:     message.Topic,
+
+		ContentType: message.ContentType(),
 	}
 
 	if message.Dst != nil {
@@ -506,6 +868,24 @@ func (api *PublicWhisperAPI) GetFilterMessages(id string) ([]*Message, error) {
 	return messages, nil
 }
 
+// FilterStats contains the delivery statistics of a message filter.
+type FilterStats struct {
+	Matched   uint64 `json:"matched"`   // Number of messages which matched the filter criteria.
+	Delivered uint64 `json:"delivered"` // Number of messages retrieved by the subscriber.
+	LastMatch int64  `json:"lastMatch"` // Unix time of the last match, 0 if nothing matched yet.
+	Buffered  int    `json:"buffered"`  // Number of messages waiting to be retrieved.
+}
+
+// GetFilterStats returns the delivery statistics of the filter with the given id.
+// It helps to tell apart a quiet topic from filter criteria which never match.
+func (api *PublicWhisperAPI) GetFilterStats(id string) (FilterStats, error) {
+	f := api.w.GetFilter(id)
+	if f == nil {
+		return FilterStats{}, fmt.Errorf("filter not found")
+	}
+	return f.Stats(), nil
+}
+
 // DeleteMessageFilter deletes a filter.
 func (api *PublicWhisperAPI) DeleteMessageFilter(id string) (bool, error) {
 	api.mu.Lock()
@@ -518,61 +898,9 @@ func (api *PublicWhisperAPI) DeleteMessageFilter(id string) (bool, error) {
 // NewMessageFilter creates a new filter that can be used to poll for
 // (new) messages that satisfy the given criteria.
 func (api *PublicWhisperAPI) NewMessageFilter(req Criteria) (string, error) {
-	var (
-		src     *ecdsa.PublicKey
-		keySym  []byte
-		keyAsym *ecdsa.PrivateKey
-		topics  [][]byte
-
-		symKeyGiven  = len(req.SymKeyID) > 0
-		asymKeyGiven = len(req.PrivateKeyID) > 0
-
-		err error
-	)
-
-	// user must specify either a symmetric or an asymmetric key
-	if (symKeyGiven && asymKeyGiven) || (!symKeyGiven && !asymKeyGiven) {
-		return "", ErrSymAsym
-	}
-
-	if len(req.Sig) > 0 {
-		src = crypto.ToECDSAPub(req.Sig)
-		if !ValidatePublicKey(src) {
-			return "", ErrInvalidSigningPubKey
-		}
-	}
-
-	if symKeyGiven {
-		if keySym, err = api.w.GetSymKey(req.SymKeyID); err != nil {
-			return "", err
-		}
-		if !validateDataIntegrity(keySym, aesKeyLength) {
-			return "", ErrInvalidSymmetricKey
-		}
-	}
-
-	if asymKeyGiven {
-		if keyAsym, err = api.w.GetPrivateKey(req.PrivateKeyID); err != nil {
-			return "", err
-		}
-	}
-
-	if len(req.Topics) > 0 {
-		topics = make([][]byte, len(req.Topics))
-		for i, topic := range req.Topics {
-			topics[i] = make([]byte, TopicLength)
-			copy(topics[i], topic[:])
-		}
-	}
-
-	f := &Filter{
-		Src:      src,
-		KeySym:   keySym,
-		KeyAsym:  keyAsym,
-		PoW:      req.MinPow,
-		AllowP2P: req.AllowP2P,
-		Topics:   topics,
-		Messages: make(map[common.Hash]*ReceivedMessage),
+	f, err := api.criteriaFilter(req)
+	if err != nil {
+		return "", err
 	}
 
 	id, err := api.w.Subscribe(f)
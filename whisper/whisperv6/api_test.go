@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
 	set "gopkg.in/fatih/set.v0"
 )
 
@@ -33,7 +34,7 @@ func TestMultipleTopicCopyInNewMessageFilter(t *testing.T) {
 		envelopes:     make(map[common.Hash]*Envelope),
 		expirations:   make(map[uint32]*set.SetNonTS),
 		peers:         make(map[*Peer]struct{}),
-		messageQueue:  make(chan *Envelope, messageQueueLimit),
+		messageQueues: []chan *Envelope{make(chan *Envelope, messageQueueLimit)},
 		p2pMsgQueue:   make(chan *Envelope, messageQueueLimit),
 		quit:          make(chan struct{}),
 		syncAllowance: DefaultSyncAllowance,
@@ -76,3 +77,103 @@ func TestMultipleTopicCopyInNewMessageFilter(t *testing.T) {
 		t.Fatalf("Could not find filter with both topics")
 	}
 }
+
+func TestMultiplexedSubscription(t *testing.T) {
+	w := New(&DefaultConfig)
+	server := rpc.NewServer()
+	if err := server.RegisterName(ProtocolName, NewPublicWhisperAPI(w)); err != nil {
+		t.Fatalf("failed to register the API: %v", err)
+	}
+	defer server.Stop()
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	keyID, err := w.GenerateSymKey()
+	if err != nil {
+		t.Fatalf("failed to generate symmetric key: %v", err)
+	}
+	installed := func() int {
+		w.filters.mutex.RLock()
+		defer w.filters.mutex.RUnlock()
+		return len(w.filters.watchers)
+	}
+	crits := []Criteria{
+		{SymKeyID: keyID, Topics: []TopicType{{0x01, 0x02, 0x03, 0x04}}},
+		{SymKeyID: keyID, Topics: []TopicType{{0x05, 0x06, 0x07, 0x08}}},
+	}
+
+	var subID rpc.ID
+	if err := client.Call(&subID, "shh_subscribe", "multiplexedMessages", crits); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if n := installed(); n != 2 {
+		t.Fatalf("wrong number of filters installed: %d", n)
+	}
+
+	var critID string
+	if err := client.Call(&critID, "shh_addSubscriptionCriteria", subID, crits[0]); err != nil {
+		t.Fatalf("failed to add criteria: %v", err)
+	}
+	if w.GetFilter(critID) == nil {
+		t.Fatalf("filter of the added criteria not installed")
+	}
+	if err := client.Call(&critID, "shh_addSubscriptionCriteria", rpc.ID("0x00"), crits[0]); err == nil {
+		t.Fatalf("criteria added to an unknown subscription")
+	}
+
+	// the subscription can only be controlled over the connection which created it
+	other := rpc.DialInProc(server)
+	defer other.Close()
+	var otherID string
+	if err := other.Call(&otherID, "shh_addSubscriptionCriteria", subID, crits[0]); err == nil {
+		t.Fatalf("criteria added over another connection")
+	}
+	var removed bool
+	if err := other.Call(&removed, "shh_removeSubscriptionCriteria", subID, critID); err == nil {
+		t.Fatalf("criteria removed over another connection")
+	}
+
+	if err := client.Call(&removed, "shh_removeSubscriptionCriteria", subID, critID); err != nil || !removed {
+		t.Fatalf("failed to remove criteria: %v", err)
+	}
+	if w.GetFilter(critID) != nil {
+		t.Fatalf("filter of the removed criteria still installed")
+	}
+
+	var unsubscribed bool
+	if err := client.Call(&unsubscribed, "shh_unsubscribe", subID); err != nil || !unsubscribed {
+		t.Fatalf("failed to unsubscribe: %v", err)
+	}
+	for i := 0; i < 100 && installed() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := installed(); n != 0 {
+		t.Fatalf("%d filters left installed after unsubscribing", n)
+	}
+}
+
+func TestReorderWindowLimit(t *testing.T) {
+	w := New(&DefaultConfig)
+	api := NewPublicWhisperAPI(w)
+
+	keyID, err := w.GenerateSymKey()
+	if err != nil {
+		t.Fatalf("failed to generate symmetric key: %v", err)
+	}
+	crit := Criteria{
+		SymKeyID:      keyID,
+		Topics:        []TopicType{{0x01, 0x02, 0x03, 0x04}},
+		ReorderWindow: DefaultTTL + 1,
+	}
+	if _, err := api.NewMessageFilter(crit); err != ErrReorderWindow {
+		t.Fatalf("unexpected error for a too long reorder window: %v", err)
+	}
+	if _, err := api.criteriaFilter(crit); err != ErrReorderWindow {
+		t.Fatalf("unexpected error for a too long reorder window: %v", err)
+	}
+
+	crit.ReorderWindow = DefaultTTL
+	if _, err := api.NewMessageFilter(crit); err != nil {
+		t.Fatalf("failed to create filter with the maximum reorder window: %v", err)
+	}
+}
@@ -18,12 +18,62 @@ package whisperv6
 
 // Config represents the configuration state of a whisper node.
 type Config struct {
-	MaxMessageSize     uint32  `toml:",omitempty"`
-	MinimumAcceptedPOW float64 `toml:",omitempty"`
+	MaxMessageSize         uint32  `toml:",omitempty"`
+	MinimumAcceptedPOW     float64 `toml:",omitempty"`
+	EnvelopeCacheSize      uint64  `toml:",omitempty"` // Maximum total size of the cached envelopes in bytes, DefaultEnvelopeCacheSize if 0
+	EnvelopeCacheRetention uint32  `toml:",omitempty"` // Maximum time an envelope is cached in seconds, 0 to honor its TTL
+
+	// PriorityTopics lists the topics of latency-sensitive traffic. Envelopes
+	// on these topics are processed through a dedicated queue and forwarded
+	// ahead of the others, so they are not delayed by bulk traffic.
+	PriorityTopics []TopicType `toml:",omitempty"`
+
+	// SenderQuota is the maximum number of signed messages per minute which
+	// are delivered to the local filters from any single sender. Messages
+	// beyond the quota are dropped after decryption. The historic messages
+	// requested from a mail server are not limited. Zero disables the quota.
+	SenderQuota uint32 `toml:",omitempty"`
+
+	// TopicPoW overrides the minimum accepted PoW for specific topics. The
+	// overrides are advertised to the peers, while peers unaware of them keep
+	// applying MinimumAcceptedPOW.
+	TopicPoW []TopicPoW `toml:",omitempty"`
+
+	// RebroadcastInterval is the average time in seconds between the rounds
+	// re-offering the still-live envelopes to a newly connected peer. Each
+	// round is randomly jittered, so that the peers do not re-broadcast in
+	// lockstep. As there is no delivery acknowledgement, every round re-sends
+	// all the live envelopes sent to the peer so far. Zero disables the
+	// re-broadcast.
+	RebroadcastInterval uint32 `toml:",omitempty"`
+
+	// SealWorkers is the number of concurrent workers performing the proof of
+	// work of envelopes on behalf of constrained clients (shh_sealEnvelope).
+	// Zero disables the service.
+	SealWorkers uint32 `toml:",omitempty"`
+
+	// SealMaxSize is the maximum size in bytes of the envelopes sealed on
+	// behalf of the clients, MaxMessageSize if zero.
+	SealMaxSize uint32 `toml:",omitempty"`
+
+	// SealMaxTime is the maximum time in seconds spent on the proof of work
+	// of an envelope sealed on behalf of the clients, 10 seconds if zero.
+	SealMaxTime uint32 `toml:",omitempty"`
+
+	// SealRate is the maximum number of envelopes sealed on behalf of each
+	// client connection per minute. Zero means unlimited.
+	SealRate uint32 `toml:",omitempty"`
+
+	// QueueShards is the number of queues the incoming messages are spread
+	// over by topic, each of them processed by a dedicated worker, so that a
+	// hot topic can't block the processing of the others. Zero defaults to
+	// the number of CPUs.
+	QueueShards uint32 `toml:",omitempty"`
 }
 
 // DefaultConfig represents (shocker!) the default configuration.
 var DefaultConfig = Config{
 	MaxMessageSize:     DefaultMaxMessageSize,
 	MinimumAcceptedPOW: DefaultMinimumPoW,
+	EnvelopeCacheSize:  DefaultEnvelopeCacheSize,
 }
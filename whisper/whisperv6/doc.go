@@ -43,11 +43,14 @@ const (
 	ProtocolVersionStr = "6.0"     // The same, as a string
 	ProtocolName       = "shh"     // Nickname of the protocol in geth
 
+	KeystoreNamespace = "shhkeystore" // RPC namespace of the private API managing the persisted key pairs
+
 	// whisper protocol message codes, according to EIP-627
 	statusCode           = 0   // used by whisper protocol
 	messagesCode         = 1   // normal whisper message
 	powRequirementCode   = 2   // PoW requirement
 	bloomFilterExCode    = 3   // bloom filter exchange
+	topicPowCode         = 4   // per-topic PoW requirements (extension, ignored by unaware peers)
 	p2pRequestCode       = 126 // peer-to-peer message, used by Dapp protocol
 	p2pMessageCode       = 127 // peer-to-peer message (to be consumed by the peer, but not forwarded any further)
 	NumberOfMessageCodes = 128
@@ -69,11 +72,16 @@ const (
 	DefaultMaxMessageSize = uint32(1024 * 1024)
 	DefaultMinimumPoW     = 0.2
 
-	padSizeLimit      = 256 // just an arbitrary number, could be changed without breaking the protocol
-	messageQueueLimit = 1024
+	DefaultEnvelopeCacheSize = uint64(256 * 1024 * 1024) // maximum total size of the cached envelopes
+
+	padSizeLimit       = 256 // just an arbitrary number, could be changed without breaking the protocol
+	messageQueueLimit  = 1024
+	priorityQueueLimit = 128
+	priorityWeight     = 4 // priority messages served in a row before the other queues get a turn
 
 	expirationCycle   = time.Second
 	transmissionCycle = 300 * time.Millisecond
+	rebroadcastRounds = 3 // number of re-broadcast rounds after a peer connects
 
 	DefaultTTL           = 50 // seconds
 	DefaultSyncAllowance = 10 // seconds
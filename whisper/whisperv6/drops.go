@@ -0,0 +1,94 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package whisperv6
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Reasons for which an incoming envelope may be dropped by the node.
+const (
+	dropLowPoW = iota
+	dropExpired
+	dropOversize
+	dropBloomMismatch
+	numDropReasons
+)
+
+const (
+	dropBucketSpan = time.Minute // time span covered by a single bucket of drop counters
+	dropBuckets    = 10          // number of buckets forming the rolling window
+	dropWindow     = dropBuckets * dropBucketSpan
+)
+
+// dropMeters maps every drop reason to the metric it is reported to.
+var dropMeters = [numDropReasons]metrics.Meter{
+	dropLowPoW:        envelopeDropLowPoWMeter,
+	dropExpired:       envelopeDropExpiredMeter,
+	dropOversize:      envelopeDropOversizeMeter,
+	dropBloomMismatch: envelopeDropBloomMeter,
+}
+
+// dropBucket holds the drop counters of a single time span.
+type dropBucket struct {
+	start  int64 // index of the time span the counters belong to
+	counts [numDropReasons]uint64
+}
+
+// dropCounter counts the dropped envelopes per reason over a rolling window
+// of time, so that recent problems are not hidden by the lifetime totals.
+type dropCounter struct {
+	mu      sync.Mutex
+	buckets [dropBuckets]dropBucket
+}
+
+// inc counts a dropped envelope for the given reason at the given time.
+func (c *dropCounter) inc(reason int, now time.Time) {
+	dropMeters[reason].Mark(1)
+
+	span := now.UnixNano() / int64(dropBucketSpan)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := &c.buckets[span%dropBuckets]
+	if b.start != span {
+		*b = dropBucket{start: span}
+	}
+	b.counts[reason]++
+}
+
+// counts returns the per reason sums of all the buckets within the
+// rolling window ending at the given time.
+func (c *dropCounter) counts(now time.Time) (res [numDropReasons]uint64) {
+	span := now.UnixNano() / int64(dropBucketSpan)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, b := range c.buckets {
+		if b.start > span-dropBuckets && b.start <= span {
+			for i, n := range b.counts {
+				res[i] += n
+			}
+		}
+	}
+	return res
+}
@@ -19,11 +19,14 @@
 package whisperv6
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"encoding/binary"
 	"fmt"
 	gmath "math"
 	"math/big"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -42,7 +45,10 @@ type Envelope struct {
 	Data   []byte
 	Nonce  uint64
 
-	pow float64 // Message-specific PoW as described in the Whisper specification.
+	pow    float64 // Message-specific PoW as described in the Whisper specification.
+	source []byte  // ID of the peer the envelope was received from, nil if originated locally.
+
+	forwards uint32 // Number of transmissions of the envelope to peers, accessed atomically.
 
 	// the following variables should not be accessed directly, use the corresponding function instead: Hash(), Bloom()
 	hash  common.Hash // Cached hash of the envelope to avoid rehashing every time.
@@ -54,6 +60,12 @@ func (e *Envelope) size() int {
 	return EnvelopeHeaderLength + len(e.Data)
 }
 
+// Forwards returns the number of times the envelope was transmitted to the
+// peers by this node.
+func (e *Envelope) Forwards() uint32 {
+	return atomic.LoadUint32(&e.forwards)
+}
+
 // rlpWithoutNonce returns the RLP encoded envelope contents, except the nonce.
 func (e *Envelope) rlpWithoutNonce() []byte {
 	res, _ := rlp.EncodeToBytes([]interface{}{e.Expiry, e.TTL, e.Topic, e.Data})
@@ -77,12 +89,27 @@ func NewEnvelope(ttl uint32, topic TopicType, msg *sentMessage) *Envelope {
 // Seal closes the envelope by spending the requested amount of time as a proof
 // of work on hashing the data.
 func (e *Envelope) Seal(options *MessageParams) error {
+	return e.SealContext(context.Background(), options)
+}
+
+// SealContext is like Seal, but aborts the proof of work as soon as the context
+// is canceled or its deadline is exceeded.
+func (e *Envelope) SealContext(ctx context.Context, options *MessageParams) error {
+	return e.SealParallel(ctx, options, 1)
+}
+
+// SealParallel is like SealContext, but spreads the proof of work over the given
+// number of concurrent workers, each of them trying a disjoint set of nonces.
+func (e *Envelope) SealParallel(ctx context.Context, options *MessageParams, workers int) error {
 	if options.PoW == 0 {
 		// PoW is not required
 		return nil
 	}
+	if workers < 1 {
+		workers = 1
+	}
 
-	var target, bestBit int
+	var target int
 	if options.PoW < 0 {
 		// target is not set - the function should run for a period
 		// of time specified in WorkTime param. Since we can predict
@@ -92,27 +119,63 @@ func (e *Envelope) Seal(options *MessageParams) error {
 		target = e.powToFirstBit(options.PoW)
 	}
 
-	buf := make([]byte, 64)
 	h := crypto.Keccak256(e.rlpWithoutNonce())
-	copy(buf[:32], h)
-
 	finish := time.Now().Add(time.Duration(options.WorkTime) * time.Second).UnixNano()
-	for nonce := uint64(0); time.Now().UnixNano() < finish; {
-		for i := 0; i < 1024; i++ {
-			binary.BigEndian.PutUint64(buf[56:], nonce)
-			d := new(big.Int).SetBytes(crypto.Keccak256(buf))
-			firstBit := math.FirstBitSet(d)
-			if firstBit > bestBit {
-				e.Nonce, bestBit = nonce, firstBit
-				if target > 0 && bestBit >= target {
-					return nil
+
+	var (
+		nonces   = make([]uint64, workers)
+		bestBits = make([]int, workers)
+		found    = make(chan struct{})
+		once     sync.Once
+		wg       sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			buf := make([]byte, 64)
+			copy(buf[:32], h)
+			// each worker hashes batches of 1024 nonces, skipping the batches of the others
+			for nonce := uint64(w) * 1024; time.Now().UnixNano() < finish; nonce += uint64(workers-1) * 1024 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-found:
+					return
+				default:
+				}
+				for i := 0; i < 1024; i++ {
+					binary.BigEndian.PutUint64(buf[56:], nonce)
+					d := new(big.Int).SetBytes(crypto.Keccak256(buf))
+					firstBit := math.FirstBitSet(d)
+					if firstBit > bestBits[w] {
+						nonces[w], bestBits[w] = nonce, firstBit
+						if target > 0 && firstBit >= target {
+							once.Do(func() { close(found) })
+							return
+						}
+					}
+					nonce++
 				}
 			}
-			nonce++
-		}
+		}(w)
 	}
+	wg.Wait()
 
-	if target > 0 && bestBit < target {
+	bestBit := 0
+	for w := 0; w < workers; w++ {
+		if bestBits[w] > bestBit {
+			e.Nonce, bestBit = nonces[w], bestBits[w]
+		}
+	}
+	if target > 0 && bestBit >= target {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if target > 0 {
 		return fmt.Errorf("failed to reach the PoW target, specified pow time (%d seconds) was insufficient", options.WorkTime)
 	}
 
@@ -19,8 +19,10 @@
 package whisperv6
 
 import (
+	"context"
 	mrand "math/rand"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 )
@@ -62,3 +64,117 @@ func TestEnvelopeOpenAcceptsOnlyOneKeyTypeInFilter(t *testing.T) {
 		t.Fatalf("Managed to decrypt a message with an invalid filter, seed %d", seed)
 	}
 }
+
+func TestEnvelopeSealCanceled(t *testing.T) {
+	params := MessageParams{
+		PoW:      1000000,
+		WorkTime: 60,
+		TTL:      DefaultTTL,
+		Payload:  make([]byte, 50),
+		KeySym:   make([]byte, aesKeyLength),
+	}
+	mrand.Read(params.KeySym)
+
+	msg, err := NewSentMessage(&params)
+	if err != nil {
+		t.Fatalf("failed to create new message with seed %d: %s.", seed, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := msg.WrapContext(ctx, &params); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("proof of work was not aborted in time: %v", elapsed)
+	}
+}
+
+func TestEnvelopeSealParallel(t *testing.T) {
+	params := MessageParams{
+		PoW:      0.01,
+		WorkTime: 10,
+		TTL:      DefaultTTL,
+		Payload:  make([]byte, 50),
+		KeySym:   make([]byte, aesKeyLength),
+	}
+	mrand.Read(params.KeySym)
+
+	env, err := wrapUnsealed(&params)
+	if err != nil {
+		t.Fatalf("failed to wrap message with seed %d: %s.", seed, err)
+	}
+	if err := env.SealParallel(context.Background(), &params, 4); err != nil {
+		t.Fatalf("failed to seal envelope: %s.", err)
+	}
+	if pow := env.PoW(); pow < params.PoW {
+		t.Fatalf("insufficient PoW of the sealed envelope: %f, want %f", pow, params.PoW)
+	}
+}
+
+func TestSealPoolLimits(t *testing.T) {
+	params := MessageParams{
+		PoW:      0.01,
+		WorkTime: 10,
+		TTL:      DefaultTTL,
+		Payload:  make([]byte, 50),
+		KeySym:   make([]byte, aesKeyLength),
+	}
+	mrand.Read(params.KeySym)
+
+	env, err := wrapUnsealed(&params)
+	if err != nil {
+		t.Fatalf("failed to wrap message with seed %d: %s.", seed, err)
+	}
+	ctx := context.Background()
+
+	if err := New(&DefaultConfig).SealEnvelope(ctx, "caller", env, &params); err != errSealingDisabled {
+		t.Fatalf("unexpected error of a disabled pool: %v", err)
+	}
+
+	cfg := DefaultConfig
+	cfg.SealWorkers = 2
+	cfg.SealRate = 1
+	cfg.SealMaxSize = uint32(env.size())
+	w := New(&cfg)
+
+	large := *env
+	large.Data = append(make([]byte, 1), env.Data...)
+	if err := w.SealEnvelope(ctx, "caller", &large, &params); err == nil {
+		t.Fatalf("oversized envelope sealed")
+	}
+	long := params
+	long.WorkTime = defaultSealMaxTime + 1
+	if err := w.SealEnvelope(ctx, "caller", env, &long); err == nil {
+		t.Fatalf("envelope sealed beyond the time limit")
+	}
+	for _, pow := range []float64{0, -1} {
+		untargeted := params
+		untargeted.PoW = pow
+		if err := w.SealEnvelope(ctx, "caller", env, &untargeted); err != errSealPowTarget {
+			t.Fatalf("unexpected error without a PoW target %f: %v", pow, err)
+		}
+	}
+	if err := w.SealEnvelope(ctx, "caller", env, &params); err != nil {
+		t.Fatalf("failed to seal envelope: %s", err)
+	}
+	if err := w.SealEnvelope(ctx, "caller", env, &params); err != errSealRateLimit {
+		t.Fatalf("unexpected error beyond the rate limit: %v", err)
+	}
+	if err := w.SealEnvelope(ctx, "other", env, &params); err != nil {
+		t.Fatalf("rate limit of another caller applied: %s", err)
+	}
+}
+
+// wrapUnsealed creates an envelope without performing its proof of work.
+func wrapUnsealed(params *MessageParams) (*Envelope, error) {
+	msg, err := NewSentMessage(params)
+	if err != nil {
+		return nil, err
+	}
+	unsealed := *params
+	unsealed.PoW = 0
+	return msg.Wrap(&unsealed)
+}
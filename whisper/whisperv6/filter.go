@@ -17,9 +17,12 @@
 package whisperv6
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -37,8 +40,22 @@ type Filter struct {
 	SymKeyHash common.Hash       // The Keccak256Hash of the symmetric key, needed for optimization
 	id         string            // unique identifier
 
+	// ReorderWindow, if non-zero, holds back every matched message for the
+	// given duration after its arrival, so that Retrieve can hand messages
+	// out sorted by their Sent timestamp rather than in arrival order.
+	ReorderWindow time.Duration
+
+	// ContentTypes, if non-empty, restricts the filter to framed payloads
+	// (see EncodePayload) of the listed content types.
+	ContentTypes []string
+
 	Messages map[common.Hash]*ReceivedMessage
+	arrivals map[common.Hash]time.Time // arrival time of buffered messages, only tracked with a reorder window
 	mutex    sync.RWMutex
+
+	matched   uint64    // number of messages which matched the filter
+	delivered uint64    // number of messages retrieved from the filter
+	lastMatch time.Time // time of the last message matching the filter
 }
 
 // Filters represents a collection of filters
@@ -176,6 +193,12 @@ func (fs *Filters) NotifyWatchers(env *Envelope, p2pMessage bool) {
 				msg = env.Open(watcher)
 				if msg == nil {
 					log.Trace("processing message: failed to open", "message", env.Hash().Hex(), "filter", watcher.id)
+				} else if !p2pMessage && !fs.whisper.senderQuota.allow(msg.Src, time.Now()) {
+					// the message is dropped for all the filters, not only for this one.
+					// The p2p messages, requested from a trusted mail server, are exempt
+					messageDropSenderQuotaMeter.Mark(1)
+					log.Trace("processing message: sender quota exceeded", "message", env.Hash().Hex())
+					return
 				}
 			} else {
 				log.Trace("processing message: does not match", "message", env.Hash().Hex(), "filter", watcher.id)
@@ -184,7 +207,7 @@ func (fs *Filters) NotifyWatchers(env *Envelope, p2pMessage bool) {
 
 		if match && msg != nil {
 			log.Trace("processing message: decrypted", "hash", env.Hash().Hex())
-			if watcher.Src == nil || IsPubKeyEqual(msg.Src, watcher.Src) {
+			if (watcher.Src == nil || IsPubKeyEqual(msg.Src, watcher.Src)) && watcher.matchContentType(msg) {
 				watcher.Trigger(msg)
 			}
 		}
@@ -207,24 +230,89 @@ func (f *Filter) Trigger(msg *ReceivedMessage) {
 
 	if _, exist := f.Messages[msg.EnvelopeHash]; !exist {
 		f.Messages[msg.EnvelopeHash] = msg
+		f.matched++
+		f.lastMatch = time.Now()
+		if f.ReorderWindow > 0 {
+			if f.arrivals == nil {
+				f.arrivals = make(map[common.Hash]time.Time)
+			}
+			f.arrivals[msg.EnvelopeHash] = time.Now()
+		}
 	}
 }
 
 // Retrieve will return the list of all received messages associated
-// to a filter.
+// to a filter. If the filter has a reorder window, only the messages
+// which have been buffered for at least that long are returned, sorted
+// by their Sent timestamp.
 func (f *Filter) Retrieve() (all []*ReceivedMessage) {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
 
+	if f.ReorderWindow > 0 {
+		all = f.retrieveOrdered(time.Now())
+		f.delivered += uint64(len(all))
+		return all
+	}
+
 	all = make([]*ReceivedMessage, 0, len(f.Messages))
 	for _, msg := range f.Messages {
 		all = append(all, msg)
 	}
 
 	f.Messages = make(map[common.Hash]*ReceivedMessage) // delete old messages
+	f.delivered += uint64(len(all))
+	return all
+}
+
+// Stats returns the delivery statistics of the filter.
+func (f *Filter) Stats() FilterStats {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	stats := FilterStats{
+		Matched:   f.matched,
+		Delivered: f.delivered,
+		Buffered:  len(f.Messages),
+	}
+	if !f.lastMatch.IsZero() {
+		stats.LastMatch = f.lastMatch.Unix()
+	}
+	return stats
+}
+
+// retrieveOrdered removes and returns the buffered messages whose reorder
+// window has elapsed at the given time, ordered by Sent timestamp. Ties are
+// broken by envelope hash so that every subscriber sees the same order.
+// A message arriving later than the window is still delivered, even if it
+// was sent before messages that have already been retrieved.
+func (f *Filter) retrieveOrdered(now time.Time) []*ReceivedMessage {
+	all := make([]*ReceivedMessage, 0, len(f.Messages))
+	for hash, msg := range f.Messages {
+		if arrived, ok := f.arrivals[hash]; ok && now.Sub(arrived) < f.ReorderWindow {
+			continue
+		}
+		all = append(all, msg)
+		delete(f.Messages, hash)
+		delete(f.arrivals, hash)
+	}
+	sort.Sort(messagesBySent(all))
 	return all
 }
 
+// messagesBySent implements sort.Interface, ordering messages by the time
+// they were posted into the network.
+type messagesBySent []*ReceivedMessage
+
+func (m messagesBySent) Len() int      { return len(m) }
+func (m messagesBySent) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m messagesBySent) Less(i, j int) bool {
+	if m[i].Sent != m[j].Sent {
+		return m[i].Sent < m[j].Sent
+	}
+	return bytes.Compare(m[i].EnvelopeHash[:], m[j].EnvelopeHash[:]) < 0
+}
+
 // MatchMessage checks if the filter matches an already decrypted
 // message (i.e. a Message that has already been handled by
 // MatchEnvelope when checked by a previous filter).
@@ -242,6 +330,21 @@ func (f *Filter) MatchMessage(msg *ReceivedMessage) bool {
 	return false
 }
 
+// matchContentType checks if the content type of the message payload is one
+// of the filter's content types. Any message matches a filter without them.
+func (f *Filter) matchContentType(msg *ReceivedMessage) bool {
+	if len(f.ContentTypes) == 0 {
+		return true
+	}
+	contentType := msg.ContentType()
+	for _, ct := range f.ContentTypes {
+		if ct == contentType {
+			return true
+		}
+	}
+	return false
+}
+
 // MatchEnvelope checks if it's worth decrypting the message. If
 // it returns `true`, client code is expected to attempt decrypting
 // the message and subsequently call MatchMessage.
@@ -24,6 +24,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
 )
 
 var seed int64
@@ -791,6 +792,82 @@ func TestWatchers(t *testing.T) {
 	}
 }
 
+func TestWatchersSenderQuota(t *testing.T) {
+	InitSingleTest()
+
+	// the meters are no-ops unless the metrics are enabled
+	enabled, meter := metrics.Enabled, messageDropSenderQuotaMeter
+	metrics.Enabled = true
+	messageDropSenderQuotaMeter = metrics.NewMeter()
+	defer func() {
+		metrics.Enabled, messageDropSenderQuotaMeter = enabled, meter
+	}()
+
+	w := New(&Config{SenderQuota: 1})
+	filters := NewFilters(w)
+
+	params, err := generateMessageParams()
+	if err != nil {
+		t.Fatalf("failed generateMessageParams with seed %d: %s.", seed, err)
+	}
+	var watchers []*Filter
+	for i := 0; i < 2; i++ {
+		f := &Filter{
+			KeySym:   params.KeySym,
+			Topics:   [][]byte{params.Topic[:]},
+			AllowP2P: true,
+			Messages: make(map[common.Hash]*ReceivedMessage),
+		}
+		if _, err := filters.Install(f); err != nil {
+			t.Fatalf("failed to install filter with seed %d: %s.", seed, err)
+		}
+		watchers = append(watchers, f)
+	}
+
+	// the sender is allowed a single message, the second one is dropped
+	for i := 0; i < 2; i++ {
+		msg, err := NewSentMessage(params)
+		if err != nil {
+			t.Fatalf("failed to create new message with seed %d: %s.", seed, err)
+		}
+		env, err := msg.Wrap(params)
+		if err != nil {
+			t.Fatalf("failed Wrap with seed %d: %s.", seed, err)
+		}
+		filters.NotifyWatchers(env, false)
+	}
+
+	for i, f := range watchers {
+		if n := len(f.Retrieve()); n != 1 {
+			t.Fatalf("filter %d: wrong number of delivered messages: have %d, want 1", i, n)
+		}
+	}
+	if n := messageDropSenderQuotaMeter.Count(); n != 1 {
+		t.Fatalf("wrong number of dropped messages: have %d, want 1", n)
+	}
+
+	// the historic messages requested from a mail server are not limited
+	for i := 0; i < 2; i++ {
+		msg, err := NewSentMessage(params)
+		if err != nil {
+			t.Fatalf("failed to create new message with seed %d: %s.", seed, err)
+		}
+		env, err := msg.Wrap(params)
+		if err != nil {
+			t.Fatalf("failed Wrap with seed %d: %s.", seed, err)
+		}
+		filters.NotifyWatchers(env, true)
+	}
+	for i, f := range watchers {
+		if n := len(f.Retrieve()); n != 2 {
+			t.Fatalf("filter %d: wrong number of delivered p2p messages: have %d, want 2", i, n)
+		}
+	}
+	if n := messageDropSenderQuotaMeter.Count(); n != 1 {
+		t.Fatalf("p2p messages dropped by the sender quota")
+	}
+}
+
 func TestVariableTopics(t *testing.T) {
 	InitSingleTest()
 
@@ -865,3 +942,83 @@ func TestMatchSingleTopic_InsufficientLength_ReturnFalse(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestReorderWindow(t *testing.T) {
+	f := &Filter{
+		ReorderWindow: time.Minute,
+		Messages:      make(map[common.Hash]*ReceivedMessage),
+	}
+
+	sent := []uint32{30, 10, 20}
+	for i, s := range sent {
+		f.Trigger(&ReceivedMessage{Sent: s, EnvelopeHash: common.BytesToHash([]byte{byte(i + 1)})})
+	}
+
+	if mail := f.Retrieve(); len(mail) != 0 {
+		t.Fatalf("retrieved %d messages before the reorder window elapsed", len(mail))
+	}
+
+	mail := f.retrieveOrdered(time.Now().Add(time.Minute))
+	if len(mail) != len(sent) {
+		t.Fatalf("retrieved %d messages, expected %d", len(mail), len(sent))
+	}
+	for i, want := range []uint32{10, 20, 30} {
+		if mail[i].Sent != want {
+			t.Fatalf("message %d: sent %d, expected %d", i, mail[i].Sent, want)
+		}
+	}
+	if len(f.Messages) != 0 || len(f.arrivals) != 0 {
+		t.Fatalf("retrieved messages were not removed from the buffer")
+	}
+}
+
+func TestFilterStats(t *testing.T) {
+	f := &Filter{Messages: make(map[common.Hash]*ReceivedMessage)}
+
+	if stats := f.Stats(); stats != (FilterStats{}) {
+		t.Fatalf("unexpected stats of a new filter: %+v", stats)
+	}
+
+	msg := &ReceivedMessage{EnvelopeHash: common.BytesToHash([]byte{0x01})}
+	f.Trigger(msg)
+	f.Trigger(msg) // duplicates are not counted
+	f.Trigger(&ReceivedMessage{EnvelopeHash: common.BytesToHash([]byte{0x02})})
+
+	stats := f.Stats()
+	if stats.Matched != 2 || stats.Delivered != 0 || stats.Buffered != 2 || stats.LastMatch == 0 {
+		t.Fatalf("unexpected stats before retrieval: %+v", stats)
+	}
+
+	f.Retrieve()
+	stats = f.Stats()
+	if stats.Matched != 2 || stats.Delivered != 2 || stats.Buffered != 0 {
+		t.Fatalf("unexpected stats after retrieval: %+v", stats)
+	}
+}
+
+func TestMatchContentType(t *testing.T) {
+	chat, err := EncodePayload("chat", []byte("hello"))
+	if err != nil {
+		t.Fatalf("failed to encode payload: %s", err)
+	}
+	receipt, err := EncodePayload("receipt", nil)
+	if err != nil {
+		t.Fatalf("failed to encode payload: %s", err)
+	}
+
+	f := &Filter{ContentTypes: []string{"chat"}}
+	if !f.matchContentType(&ReceivedMessage{Payload: chat}) {
+		t.Fatalf("message with a listed content type did not match")
+	}
+	if f.matchContentType(&ReceivedMessage{Payload: receipt}) {
+		t.Fatalf("message with another content type matched")
+	}
+	if f.matchContentType(&ReceivedMessage{Payload: []byte("unframed")}) {
+		t.Fatalf("unframed message matched")
+	}
+
+	f = &Filter{}
+	if !f.matchContentType(&ReceivedMessage{Payload: []byte("unframed")}) {
+		t.Fatalf("filter without content types rejected a message")
+	}
+}
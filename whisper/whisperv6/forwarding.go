@@ -0,0 +1,51 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package whisperv6
+
+// ForwardingPolicy decides whether an envelope should be relayed to a peer.
+// It is consulted for every envelope and peer, after the protocol level
+// requirements of the peer (PoW and bloom filter) have been checked, and must
+// therefore return quickly. Implementations must be safe for concurrent use.
+//
+// Rejected envelopes are not marked as known to the peer, so they are offered
+// to the policy again on every transmission cycle (300 ms) for as long as they
+// live, once per peer.
+type ForwardingPolicy interface {
+	Forward(env *Envelope, info *ForwardingContext) bool
+}
+
+// ForwardingContext holds the information available to a ForwardingPolicy
+// when deciding whether an envelope should be relayed.
+type ForwardingContext struct {
+	Topic         TopicType // Topic of the envelope
+	PoW           float64   // Proof of work of the envelope
+	Size          int       // Size of the envelope in bytes
+	Source        []byte    // ID of the peer the envelope was received from, nil if it originates from this node
+	Target        []byte    // ID of the peer the envelope is about to be relayed to
+	QueuePressure float64   // Fill ratio of the most loaded local message queue, between 0 and 1
+}
+
+// defaultForwardingPolicy relays every envelope, which is the behaviour
+// mandated by the protocol.
+type defaultForwardingPolicy struct{}
+
+func (defaultForwardingPolicy) Forward(*Envelope, *ForwardingContext) bool {
+	return true
+}
+
+// DefaultForwardingPolicy is the policy used unless another one is set.
+var DefaultForwardingPolicy ForwardingPolicy = defaultForwardingPolicy{}
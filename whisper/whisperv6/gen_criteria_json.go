@@ -13,12 +13,14 @@ var _ = (*criteriaOverride)(nil)
 // MarshalJSON marshals type Criteria to a json string
 func (c Criteria) MarshalJSON() ([]byte, error) {
 	type Criteria struct {
-		SymKeyID     string        `json:"symKeyID"`
-		PrivateKeyID string        `json:"privateKeyID"`
-		Sig          hexutil.Bytes `json:"sig"`
-		MinPow       float64       `json:"minPow"`
-		Topics       []TopicType   `json:"topics"`
-		AllowP2P     bool          `json:"allowP2P"`
+		SymKeyID      string        `json:"symKeyID"`
+		PrivateKeyID  string        `json:"privateKeyID"`
+		Sig           hexutil.Bytes `json:"sig"`
+		MinPow        float64       `json:"minPow"`
+		Topics        []TopicType   `json:"topics"`
+		AllowP2P      bool          `json:"allowP2P"`
+		ReorderWindow uint32        `json:"reorderWindow"`
+		ContentTypes  []string      `json:"contentTypes"`
 	}
 	var enc Criteria
 	enc.SymKeyID = c.SymKeyID
@@ -27,18 +29,22 @@ func (c Criteria) MarshalJSON() ([]byte, error) {
 	enc.MinPow = c.MinPow
 	enc.Topics = c.Topics
 	enc.AllowP2P = c.AllowP2P
+	enc.ReorderWindow = c.ReorderWindow
+	enc.ContentTypes = c.ContentTypes
 	return json.Marshal(&enc)
 }
 
 // UnmarshalJSON unmarshals type Criteria to a json string
 func (c *Criteria) UnmarshalJSON(input []byte) error {
 	type Criteria struct {
-		SymKeyID     *string        `json:"symKeyID"`
-		PrivateKeyID *string        `json:"privateKeyID"`
-		Sig          *hexutil.Bytes `json:"sig"`
-		MinPow       *float64       `json:"minPow"`
-		Topics       []TopicType    `json:"topics"`
-		AllowP2P     *bool          `json:"allowP2P"`
+		SymKeyID      *string        `json:"symKeyID"`
+		PrivateKeyID  *string        `json:"privateKeyID"`
+		Sig           *hexutil.Bytes `json:"sig"`
+		MinPow        *float64       `json:"minPow"`
+		Topics        []TopicType    `json:"topics"`
+		AllowP2P      *bool          `json:"allowP2P"`
+		ReorderWindow *uint32        `json:"reorderWindow"`
+		ContentTypes  []string       `json:"contentTypes"`
 	}
 	var dec Criteria
 	if err := json.Unmarshal(input, &dec); err != nil {
@@ -62,5 +68,11 @@ func (c *Criteria) UnmarshalJSON(input []byte) error {
 	if dec.AllowP2P != nil {
 		c.AllowP2P = *dec.AllowP2P
 	}
+	if dec.ReorderWindow != nil {
+		c.ReorderWindow = *dec.ReorderWindow
+	}
+	if dec.ContentTypes != nil {
+		c.ContentTypes = dec.ContentTypes
+	}
 	return nil
 }
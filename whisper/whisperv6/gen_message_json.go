@@ -13,15 +13,16 @@ var _ = (*messageOverride)(nil)
 // MarshalJSON marshals type Message to a json string
 func (m Message) MarshalJSON() ([]byte, error) {
 	type Message struct {
-		Sig       hexutil.Bytes `json:"sig,omitempty"`
-		TTL       uint32        `json:"ttl"`
-		Timestamp uint32        `json:"timestamp"`
-		Topic     TopicType     `json:"topic"`
-		Payload   hexutil.Bytes `json:"payload"`
-		Padding   hexutil.Bytes `json:"padding"`
-		PoW       float64       `json:"pow"`
-		Hash      hexutil.Bytes `json:"hash"`
-		Dst       hexutil.Bytes `json:"recipientPublicKey,omitempty"`
+		Sig         hexutil.Bytes `json:"sig,omitempty"`
+		TTL         uint32        `json:"ttl"`
+		Timestamp   uint32        `json:"timestamp"`
+		Topic       TopicType     `json:"topic"`
+		Payload     hexutil.Bytes `json:"payload"`
+		Padding     hexutil.Bytes `json:"padding"`
+		PoW         float64       `json:"pow"`
+		Hash        hexutil.Bytes `json:"hash"`
+		Dst         hexutil.Bytes `json:"recipientPublicKey,omitempty"`
+		ContentType string        `json:"contentType,omitempty"`
 	}
 	var enc Message
 	enc.Sig = m.Sig
@@ -33,21 +34,23 @@ func (m Message) MarshalJSON() ([]byte, error) {
 	enc.PoW = m.PoW
 	enc.Hash = m.Hash
 	enc.Dst = m.Dst
+	enc.ContentType = m.ContentType
 	return json.Marshal(&enc)
 }
 
 // UnmarshalJSON unmarshals type Message to a json string
 func (m *Message) UnmarshalJSON(input []byte) error {
 	type Message struct {
-		Sig       *hexutil.Bytes `json:"sig,omitempty"`
-		TTL       *uint32        `json:"ttl"`
-		Timestamp *uint32        `json:"timestamp"`
-		Topic     *TopicType     `json:"topic"`
-		Payload   *hexutil.Bytes `json:"payload"`
-		Padding   *hexutil.Bytes `json:"padding"`
-		PoW       *float64       `json:"pow"`
-		Hash      *hexutil.Bytes `json:"hash"`
-		Dst       *hexutil.Bytes `json:"recipientPublicKey,omitempty"`
+		Sig         *hexutil.Bytes `json:"sig,omitempty"`
+		TTL         *uint32        `json:"ttl"`
+		Timestamp   *uint32        `json:"timestamp"`
+		Topic       *TopicType     `json:"topic"`
+		Payload     *hexutil.Bytes `json:"payload"`
+		Padding     *hexutil.Bytes `json:"padding"`
+		PoW         *float64       `json:"pow"`
+		Hash        *hexutil.Bytes `json:"hash"`
+		Dst         *hexutil.Bytes `json:"recipientPublicKey,omitempty"`
+		ContentType *string        `json:"contentType,omitempty"`
 	}
 	var dec Message
 	if err := json.Unmarshal(input, &dec); err != nil {
@@ -80,5 +83,8 @@ func (m *Message) UnmarshalJSON(input []byte) error {
 	if dec.Dst != nil {
 		m.Dst = *dec.Dst
 	}
+	if dec.ContentType != nil {
+		m.ContentType = *dec.ContentType
+	}
 	return nil
 }
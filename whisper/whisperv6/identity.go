@@ -0,0 +1,182 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Contains the persistent store of the asymmetric identities of the node.
+
+package whisperv6
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pborman/uuid"
+)
+
+var errNoIdentityStore = errors.New("no identity store configured")
+
+// identityStore keeps the key pairs of the node encrypted in a keystore
+// directory, one file per identity named after its ID.
+type identityStore struct {
+	dir     string
+	scryptN int
+	scryptP int
+}
+
+// path returns the file of the identity with the given ID.
+func (ks *identityStore) path(id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || len(id) != keyIDSize*2 {
+		return "", fmt.Errorf("invalid id")
+	}
+	return filepath.Join(ks.dir, id), nil
+}
+
+// SetIdentityStore configures the directory where the key pairs are persisted
+// with PersistKeyPair, encrypted with the given scrypt parameters.
+func (whisper *Whisper) SetIdentityStore(dir string, scryptN, scryptP int) {
+	whisper.keyMu.Lock()
+	defer whisper.keyMu.Unlock()
+	whisper.identities = &identityStore{dir: dir, scryptN: scryptN, scryptP: scryptP}
+}
+
+// identityStore returns the configured identity store.
+func (whisper *Whisper) identityStore() (*identityStore, error) {
+	whisper.keyMu.RLock()
+	defer whisper.keyMu.RUnlock()
+	if whisper.identities == nil {
+		return nil, errNoIdentityStore
+	}
+	return whisper.identities, nil
+}
+
+// PersistKeyPair stores the key pair with the given ID, encrypted with the
+// passphrase, so that it can be restored with UnlockKeyPair after a restart.
+func (whisper *Whisper) PersistKeyPair(id string, passphrase string) error {
+	ks, err := whisper.identityStore()
+	if err != nil {
+		return err
+	}
+	path, err := ks.path(id)
+	if err != nil {
+		return err
+	}
+	key, err := whisper.GetPrivateKey(id)
+	if err != nil {
+		return err
+	}
+	keyjson, err := keystore.EncryptKey(&keystore.Key{
+		Id:         uuid.NewRandom(),
+		Address:    crypto.PubkeyToAddress(key.PublicKey),
+		PrivateKey: key,
+	}, passphrase, ks.scryptN, ks.scryptP)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ks.dir, 0700); err != nil {
+		return err
+	}
+	// write to a temporary file first, so that a crash can't leave a
+	// truncated identity behind
+	f, err := ioutil.TempFile(ks.dir, "."+id+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(keyjson); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	f.Close()
+	return os.Rename(f.Name(), path)
+}
+
+// UnlockKeyPair decrypts the persisted key pair with the given ID and makes it
+// available to the node under the same ID.
+func (whisper *Whisper) UnlockKeyPair(id string, passphrase string) error {
+	key, err := whisper.decryptKeyPair(id, passphrase)
+	if err != nil {
+		return err
+	}
+	if !validatePrivateKey(key.PrivateKey) {
+		return fmt.Errorf("invalid private key")
+	}
+
+	whisper.keyMu.Lock()
+	defer whisper.keyMu.Unlock()
+	whisper.privateKeys[id] = key.PrivateKey
+	return nil
+}
+
+// DeletePersistedKeyPair removes the persisted key pair with the given ID.
+// The passphrase is verified before deleting. The key pair remains available
+// to the node until it is deleted with DeleteKeyPair.
+func (whisper *Whisper) DeletePersistedKeyPair(id string, passphrase string) error {
+	if _, err := whisper.decryptKeyPair(id, passphrase); err != nil {
+		return err
+	}
+	ks, err := whisper.identityStore()
+	if err != nil {
+		return err
+	}
+	path, err := ks.path(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// PersistedKeyPairs returns the IDs of the persisted key pairs.
+func (whisper *Whisper) PersistedKeyPairs() ([]string, error) {
+	ks, err := whisper.identityStore()
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(ks.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, fi := range files {
+		if _, err := ks.path(fi.Name()); err == nil && fi.Mode().IsRegular() {
+			ids = append(ids, fi.Name())
+		}
+	}
+	return ids, nil
+}
+
+// decryptKeyPair loads and decrypts the persisted key pair with the given ID.
+func (whisper *Whisper) decryptKeyPair(id string, passphrase string) (*keystore.Key, error) {
+	ks, err := whisper.identityStore()
+	if err != nil {
+		return nil, err
+	}
+	path, err := ks.path(id)
+	if err != nil {
+		return nil, err
+	}
+	keyjson, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return keystore.DecryptKey(keyjson, passphrase)
+}
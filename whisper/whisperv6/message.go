@@ -19,6 +19,7 @@
 package whisperv6
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/ecdsa"
@@ -235,6 +236,12 @@ func generateSecureRandomData(length int) ([]byte, error) {
 
 // Wrap bundles the message into an Envelope to transmit over the network.
 func (msg *sentMessage) Wrap(options *MessageParams) (envelope *Envelope, err error) {
+	return msg.WrapContext(context.Background(), options)
+}
+
+// WrapContext is like Wrap, but aborts sealing the envelope as soon as the
+// context is canceled or its deadline is exceeded.
+func (msg *sentMessage) WrapContext(ctx context.Context, options *MessageParams) (envelope *Envelope, err error) {
 	if options.TTL == 0 {
 		options.TTL = DefaultTTL
 	}
@@ -255,7 +262,7 @@ func (msg *sentMessage) Wrap(options *MessageParams) (envelope *Envelope, err er
 	}
 
 	envelope = NewEnvelope(options.TTL, options.Topic, msg)
-	if err = envelope.Seal(options); err != nil {
+	if err = envelope.SealContext(ctx, options); err != nil {
 		return nil, err
 	}
 	return envelope, nil
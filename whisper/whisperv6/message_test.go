@@ -469,3 +469,38 @@ func TestAesNonce(t *testing.T) {
 		t.Fatalf("Nonce size is wrong. This is a critical error. Apparently AES nonce size have changed in the new version of AES GCM package. Whisper will not be working until this problem is resolved.")
 	}
 }
+
+func TestPayloadFraming(t *testing.T) {
+	data := []byte("payload")
+	payload, err := EncodePayload("application/json", data)
+	if err != nil {
+		t.Fatalf("failed to encode payload: %s", err)
+	}
+	contentType, decoded, err := DecodePayload(payload)
+	if err != nil {
+		t.Fatalf("failed to decode payload: %s", err)
+	}
+	if contentType != "application/json" || !bytes.Equal(decoded, data) {
+		t.Fatalf("payload roundtrip failed: %q, %x", contentType, decoded)
+	}
+	if ct := (&ReceivedMessage{Payload: payload}).ContentType(); ct != contentType {
+		t.Fatalf("wrong content type of the message: %q", ct)
+	}
+
+	if _, err := EncodePayload("", data); err == nil {
+		t.Fatalf("empty content type accepted")
+	}
+	if _, err := EncodePayload(string(make([]byte, maxContentTypeLength+1)), data); err == nil {
+		t.Fatalf("too long content type accepted")
+	}
+	// unframed data which happens to look like a frame is not decoded
+	if _, _, err := DecodePayload([]byte{PayloadFrameVersion, 0x01, 'a'}); err != errUnframedPayload {
+		t.Fatalf("unframed payload decoded: %v", err)
+	}
+	for _, invalid := range [][]byte{nil, {PayloadFrameVersion}, {0x02, 0x01, 'a'}, {PayloadFrameVersion, 0x00}, {PayloadFrameVersion, 0x05, 'a'}} {
+		invalid = append(append([]byte{}, payloadFrameMagic...), invalid...)
+		if _, _, err := DecodePayload(invalid); err == nil {
+			t.Fatalf("invalid payload %x decoded", invalid)
+		}
+	}
+}
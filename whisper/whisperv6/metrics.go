@@ -0,0 +1,36 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Contains the metrics collected by the whisper node.
+
+package whisperv6
+
+import (
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	envelopeDropLowPoWMeter   = metrics.NewRegisteredMeter("whisper/envelopes/drop/lowpow", nil)
+	envelopeDropExpiredMeter  = metrics.NewRegisteredMeter("whisper/envelopes/drop/expired", nil)
+	envelopeDropOversizeMeter = metrics.NewRegisteredMeter("whisper/envelopes/drop/oversize", nil)
+	envelopeDropBloomMeter    = metrics.NewRegisteredMeter("whisper/envelopes/drop/bloom", nil)
+
+	messageDropSenderQuotaMeter = metrics.NewRegisteredMeter("whisper/messages/drop/quota", nil)
+	messageDropQueueFullMeter   = metrics.NewRegisteredMeter("whisper/messages/drop/queue", nil)
+
+	envelopeForwardMeter     = metrics.NewRegisteredMeter("whisper/envelopes/forward", nil)
+	envelopeRebroadcastMeter = metrics.NewRegisteredMeter("whisper/envelopes/rebroadcast", nil)
+)
@@ -0,0 +1,89 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Contains the optional framing of the message payloads, which tags the
+// application data with its content type.
+
+package whisperv6
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// payloadFrameMagic starts every framed payload, so that the application data
+// of unframed payloads is not mistaken for a frame.
+var payloadFrameMagic = []byte{0x73, 0x68, 0x68, 0xfa} // "shh" and 0xfa
+
+// PayloadFrameVersion is the version of the payload framing produced by
+// EncodePayload.
+const PayloadFrameVersion = 1
+
+// maxContentTypeLength is the maximum length of a content type in bytes.
+const maxContentTypeLength = 255
+
+// errUnframedPayload is returned by DecodePayload for payloads which were
+// not produced by EncodePayload.
+var errUnframedPayload = errors.New("payload is not framed")
+
+// EncodePayload frames the application data with its content type, so that
+// several kinds of messages can be multiplexed on a single topic. The framed
+// payload consists of a magic prefix, the version byte, the length of the
+// content type, the content type and the data.
+func EncodePayload(contentType string, data []byte) ([]byte, error) {
+	if len(contentType) == 0 {
+		return nil, errors.New("empty content type")
+	}
+	if len(contentType) > maxContentTypeLength {
+		return nil, fmt.Errorf("content type too long: %d bytes", len(contentType))
+	}
+	payload := make([]byte, 0, len(payloadFrameMagic)+2+len(contentType)+len(data))
+	payload = append(payload, payloadFrameMagic...)
+	payload = append(payload, PayloadFrameVersion, byte(len(contentType)))
+	payload = append(payload, contentType...)
+	return append(payload, data...), nil
+}
+
+// DecodePayload splits a payload produced by EncodePayload into its content
+// type and the application data.
+func DecodePayload(payload []byte) (string, []byte, error) {
+	if !bytes.HasPrefix(payload, payloadFrameMagic) {
+		return "", nil, errUnframedPayload
+	}
+	payload = payload[len(payloadFrameMagic):]
+	if len(payload) < 2 {
+		return "", nil, errors.New("truncated payload frame")
+	}
+	if payload[0] != PayloadFrameVersion {
+		return "", nil, fmt.Errorf("unsupported payload frame version %d", payload[0])
+	}
+	size := int(payload[1])
+	if size == 0 || len(payload) < 2+size {
+		return "", nil, errors.New("invalid content type length")
+	}
+	return string(payload[2 : 2+size]), payload[2+size:], nil
+}
+
+// ContentType returns the content type of a framed message payload, or an
+// empty string if the payload is not framed.
+func (msg *ReceivedMessage) ContentType() string {
+	contentType, _, err := DecodePayload(msg.Payload)
+	if err != nil {
+		return ""
+	}
+	return contentType
+}
@@ -19,7 +19,9 @@ package whisperv6
 import (
 	"fmt"
 	"math"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -41,24 +43,34 @@ type Peer struct {
 	bloomFilter    []byte
 	fullNode       bool
 
-	known *set.Set // Messages already known by the peer to avoid wasting bandwidth
+	topicPowMu   sync.RWMutex
+	topicPowReqs map[TopicType]float64 // PoW requirements of the peer overriding powRequirement for specific topics
+
+	known        *set.Set // Messages already known by the peer to avoid wasting bandwidth
+	forwarded    *set.Set // Messages sent to the peer, to be re-sent by the re-broadcast rounds
+	rebroadcasts int      // Re-broadcast rounds still due, only accessed by the update loop
 
 	quit chan struct{}
 }
 
 // newPeer creates a new whisper peer object, but does not run the handshake itself.
 func newPeer(host *Whisper, remote *p2p.Peer, rw p2p.MsgReadWriter) *Peer {
-	return &Peer{
+	peer := &Peer{
 		host:           host,
 		peer:           remote,
 		ws:             rw,
 		trusted:        false,
 		powRequirement: 0.0,
 		known:          set.New(),
+		forwarded:      set.New(),
 		quit:           make(chan struct{}),
 		bloomFilter:    MakeFullNodeBloom(),
 		fullNode:       true,
 	}
+	if host != nil && host.rebroadcastInterval > 0 {
+		peer.rebroadcasts = rebroadcastRounds
+	}
+	return peer
 }
 
 // start initiates the peer updater, periodically broadcasting the whisper packets
@@ -83,7 +95,8 @@ func (peer *Peer) handshake() error {
 		pow := peer.host.MinPow()
 		powConverted := math.Float64bits(pow)
 		bloom := peer.host.BloomFilter()
-		errc <- p2p.SendItems(peer.ws, statusCode, ProtocolVersion, powConverted, bloom)
+		topicPow := encodeTopicPow(peer.host.topicPow(topicPowIdx))
+		errc <- p2p.SendItems(peer.ws, statusCode, ProtocolVersion, powConverted, bloom, topicPow)
 	}()
 
 	// Fetch the remote status packet and verify protocol match
@@ -124,6 +137,16 @@ func (peer *Peer) handshake() error {
 				return fmt.Errorf("peer [%x] sent bad status message: wrong bloom filter size %d", peer.ID(), sz)
 			}
 			peer.setBloomFilter(bloom)
+
+			// the per-topic requirements are an extension, not sent by every peer
+			var reqs []topicPowRequirement
+			if err = s.Decode(&reqs); err == nil {
+				topicPow, err := decodeTopicPow(reqs)
+				if err != nil {
+					return fmt.Errorf("peer [%x] sent bad status message: %v", peer.ID(), err)
+				}
+				peer.setTopicPowRequirements(topicPow)
+			}
 		}
 	}
 
@@ -140,12 +163,26 @@ func (peer *Peer) update() {
 	expire := time.NewTicker(expirationCycle)
 	transmit := time.NewTicker(transmissionCycle)
 
+	// Schedule the re-broadcast rounds, if enabled
+	var rebroadcast <-chan time.Time
+	if peer.rebroadcasts > 0 {
+		rebroadcast = time.After(peer.rebroadcastDelay())
+	}
+
 	// Loop and transmit until termination is requested
 	for {
 		select {
 		case <-expire.C:
 			peer.expire()
 
+		case <-rebroadcast:
+			peer.rebroadcast()
+			if peer.rebroadcasts > 0 {
+				rebroadcast = time.After(peer.rebroadcastDelay())
+			} else {
+				rebroadcast = nil
+			}
+
 		case <-transmit.C:
 			if err := peer.broadcast(); err != nil {
 				log.Trace("broadcast failed", "reason", err, "peer", peer.ID())
@@ -168,6 +205,49 @@ func (peer *Peer) marked(envelope *Envelope) bool {
 	return peer.known.Has(envelope.Hash())
 }
 
+// rebroadcastDelay returns the time until the next re-broadcast round, drawn
+// uniformly from [interval/2, interval*3/2) to avoid synchronized traffic
+// spikes across the peers.
+func (peer *Peer) rebroadcastDelay() time.Duration {
+	interval := peer.host.rebroadcastInterval
+	return interval/2 + time.Duration(rand.Int63n(int64(interval)))
+}
+
+// rebroadcast forgets the still-live envelopes previously sent to the peer, so
+// that they are offered again with the next broadcast. There is no delivery
+// acknowledgement in the protocol, so each round re-sends every live envelope
+// sent to the peer so far, except those the peer happened to send us since.
+// With rebroadcastRounds rounds this may cost up to that many times the traffic
+// of the initial exchange with the peer. The sent envelopes are only tracked
+// while rounds are still due.
+func (peer *Peer) rebroadcast() int {
+	if peer.rebroadcasts == 0 {
+		return 0
+	}
+	peer.rebroadcasts--
+
+	now := uint32(time.Now().Unix())
+	unmark := make(map[common.Hash]struct{})
+	peer.forwarded.Each(func(v interface{}) bool {
+		hash := v.(common.Hash)
+		if env := peer.host.GetEnvelope(hash); env != nil && env.Expiry > now {
+			unmark[hash] = struct{}{}
+		}
+		return true
+	})
+	for hash := range unmark {
+		peer.known.Remove(hash)
+		peer.forwarded.Remove(hash)
+	}
+	if peer.rebroadcasts == 0 {
+		// no more rounds, the sent envelopes need not be tracked any longer
+		peer.forwarded.Clear()
+	}
+	envelopeRebroadcastMeter.Mark(int64(len(unmark)))
+	log.Trace("rebroadcast", "num. messages", len(unmark), "peer", peer.ID())
+	return len(unmark)
+}
+
 // expire iterates over all the known envelopes in the host and removes all
 // expired (unknown) ones from the known list.
 func (peer *Peer) expire() {
@@ -181,6 +261,7 @@ func (peer *Peer) expire() {
 	// Dump all known but no longer cached
 	for hash := range unmark {
 		peer.known.Remove(hash)
+		peer.forwarded.Remove(hash)
 	}
 }
 
@@ -189,9 +270,29 @@ func (peer *Peer) expire() {
 func (peer *Peer) broadcast() error {
 	envelopes := peer.host.Envelopes()
 	bundle := make([]*Envelope, 0, len(envelopes))
+	priority := 0
+	policy := peer.host.ForwardingPolicy()
+	pressure := peer.host.queuePressure()
 	for _, envelope := range envelopes {
-		if !peer.marked(envelope) && envelope.PoW() >= peer.powRequirement && peer.bloomMatch(envelope) {
+		if !peer.marked(envelope) && envelope.PoW() >= peer.powRequirementFor(envelope.Topic) && peer.bloomMatch(envelope) {
+			info := &ForwardingContext{
+				Topic:         envelope.Topic,
+				PoW:           envelope.PoW(),
+				Size:          envelope.size(),
+				Source:        envelope.source,
+				Target:        peer.ID(),
+				QueuePressure: pressure,
+			}
+			if !policy.Forward(envelope, info) {
+				continue
+			}
 			bundle = append(bundle, envelope)
+			// envelopes on priority topics are moved to the front of the bundle
+			if peer.host.isPriority(envelope) {
+				last := len(bundle) - 1
+				bundle[priority], bundle[last] = bundle[last], bundle[priority]
+				priority++
+			}
 		}
 	}
 
@@ -204,7 +305,12 @@ func (peer *Peer) broadcast() error {
 		// mark envelopes only if they were successfully sent
 		for _, e := range bundle {
 			peer.mark(e)
+			if peer.rebroadcasts > 0 {
+				peer.forwarded.Add(e.Hash())
+			}
+			atomic.AddUint32(&e.forwards, 1)
 		}
+		envelopeForwardMeter.Mark(int64(len(bundle)))
 
 		log.Trace("broadcast", "num. messages", len(bundle))
 	}
@@ -222,6 +328,26 @@ func (peer *Peer) notifyAboutPowRequirementChange(pow float64) error {
 	return p2p.Send(peer.ws, powRequirementCode, i)
 }
 
+func (peer *Peer) notifyAboutTopicPowChange(reqs []topicPowRequirement) error {
+	return p2p.Send(peer.ws, topicPowCode, reqs)
+}
+
+// powRequirementFor returns the PoW required by the peer for the given topic.
+func (peer *Peer) powRequirementFor(topic TopicType) float64 {
+	peer.topicPowMu.RLock()
+	defer peer.topicPowMu.RUnlock()
+	if pow, ok := peer.topicPowReqs[topic]; ok {
+		return pow
+	}
+	return peer.powRequirement
+}
+
+func (peer *Peer) setTopicPowRequirements(reqs map[TopicType]float64) {
+	peer.topicPowMu.Lock()
+	defer peer.topicPowMu.Unlock()
+	peer.topicPowReqs = reqs
+}
+
 func (peer *Peer) notifyAboutBloomFilterChange(bloom []byte) error {
 	return p2p.Send(peer.ws, bloomFilterExCode, bloom)
 }
@@ -512,3 +512,146 @@ func waitForServersToStart(t *testing.T) {
 	}
 	t.Fatalf("Failed to start all the servers, running: %d", started)
 }
+
+type topicBlockingPolicy struct {
+	blocked TopicType
+}
+
+func (p topicBlockingPolicy) Forward(env *Envelope, info *ForwardingContext) bool {
+	return info.Topic != p.blocked
+}
+
+func TestForwardingPolicy(t *testing.T) {
+	InitSingleTest()
+
+	cfg := DefaultConfig
+	cfg.MinimumAcceptedPOW = 0
+	w := New(&cfg)
+
+	topics := []TopicType{{0x01, 0x01, 0x01, 0x01}, {0x02, 0x02, 0x02, 0x02}}
+	for _, topic := range topics {
+		sendTestEnvelope(t, w, topic, 10)
+	}
+	w.SetForwardingPolicy(topicBlockingPolicy{blocked: topics[0]})
+
+	local, remote := p2p.MsgPipe()
+	defer local.Close()
+	p := newPeer(w, p2p.NewPeer(discover.NodeID{0x01}, "test", nil), local)
+
+	errc := make(chan error, 1)
+	go func() { errc <- p.broadcast() }()
+
+	packet, err := remote.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read the broadcast: %s.", err)
+	}
+	var envelopes []*Envelope
+	if err := packet.Decode(&envelopes); err != nil {
+		t.Fatalf("failed to decode the broadcast: %s.", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("broadcast failed: %s.", err)
+	}
+	if len(envelopes) != 1 || envelopes[0].Topic != topics[1] {
+		t.Fatalf("the forwarding policy was not applied, relayed %d envelopes", len(envelopes))
+	}
+}
+
+func TestTopicPowHandshake(t *testing.T) {
+	topic := TopicType{0x01, 0x02, 0x03, 0x04}
+	cfg := DefaultConfig
+	cfg.TopicPoW = []TopicPoW{{Topic: topic, PoW: 5}}
+	w1 := New(&cfg)
+	w2 := New(&DefaultConfig)
+
+	rw1, rw2 := p2p.MsgPipe()
+	defer rw1.Close()
+	p1 := newPeer(w1, p2p.NewPeer(discover.NodeID{0x02}, "w2", nil), rw1)
+	p2 := newPeer(w2, p2p.NewPeer(discover.NodeID{0x01}, "w1", nil), rw2)
+
+	errc := make(chan error, 1)
+	go func() { errc <- p1.handshake() }()
+	if err := p2.handshake(); err != nil {
+		t.Fatalf("handshake failed: %s.", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("handshake failed: %s.", err)
+	}
+
+	if pow := p2.powRequirementFor(topic); pow != 5 {
+		t.Fatalf("wrong pow requirement for the overridden topic: have %f, want 5", pow)
+	}
+	if pow := p2.powRequirementFor(TopicType{}); pow != w1.MinPow() {
+		t.Fatalf("wrong pow requirement for other topics: have %f, want %f", pow, w1.MinPow())
+	}
+	if pow := p1.powRequirementFor(topic); pow != w2.MinPow() {
+		t.Fatalf("wrong pow requirement of a peer without overrides: have %f, want %f", pow, w2.MinPow())
+	}
+}
+
+func TestRebroadcast(t *testing.T) {
+	InitSingleTest()
+
+	cfg := DefaultConfig
+	cfg.MinimumAcceptedPOW = 0
+	cfg.RebroadcastInterval = 10
+	w := New(&cfg)
+
+	env := sendTestEnvelope(t, w, TopicType{0x01, 0x02, 0x03, 0x04}, 10)
+
+	local, remote := p2p.MsgPipe()
+	defer local.Close()
+	p := newPeer(w, p2p.NewPeer(discover.NodeID{0x01}, "test", nil), local)
+
+	for i := 0; i < 2; i++ {
+		errc := make(chan error, 1)
+		go func() { errc <- p.broadcast() }()
+		packet, err := remote.ReadMsg()
+		if err != nil {
+			t.Fatalf("failed to read the broadcast %d: %s.", i, err)
+		}
+		packet.Discard()
+		if err := <-errc; err != nil {
+			t.Fatalf("broadcast %d failed: %s.", i, err)
+		}
+		if forwards, _ := w.EnvelopeForwards(env.Hash()); forwards != uint32(i+1) {
+			t.Fatalf("wrong forwarding counter after broadcast %d: %d.", i, forwards)
+		}
+		if n := p.rebroadcast(); n != 1 {
+			t.Fatalf("wrong number of envelopes re-offered after broadcast %d: %d.", i, n)
+		}
+	}
+
+	// an envelope is re-offered only once per broadcast
+	if n := p.rebroadcast(); n != 0 {
+		t.Fatalf("envelope re-offered without being sent again.")
+	}
+
+	// once the rounds are used up, the sent envelopes are no longer tracked
+	sendTestEnvelope(t, w, TopicType{0x01, 0x02, 0x03, 0x04}, 10)
+	errc := make(chan error, 1)
+	go func() { errc <- p.broadcast() }()
+	packet, err := remote.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read the final broadcast: %s.", err)
+	}
+	packet.Discard()
+	if err := <-errc; err != nil {
+		t.Fatalf("final broadcast failed: %s.", err)
+	}
+	if n := p.forwarded.Size(); n != 0 {
+		t.Fatalf("%d envelopes tracked after the re-broadcast rounds.", n)
+	}
+
+	// nor are they without re-broadcast
+	if p := newPeer(New(&DefaultConfig), nil, nil); p.rebroadcasts != 0 {
+		t.Fatalf("re-broadcast rounds due with re-broadcast disabled.")
+	}
+
+	for i := 0; i < 100; i++ {
+		delay := p.rebroadcastDelay()
+		if delay < 5*time.Second || delay >= 15*time.Second {
+			t.Fatalf("re-broadcast delay out of bounds: %v.", delay)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package whisperv6
+
+import (
+	"crypto/ecdsa"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const senderQuotaPeriod = time.Minute // period over which the messages of a sender are counted
+
+// senderQuota limits the number of messages delivered to the local filters
+// from any single signing identity, so that a hostile sender can't flood the
+// dapps listening on a topic.
+type senderQuota struct {
+	limit uint32 // maximum number of messages per sender and period
+
+	mu     sync.Mutex
+	period int64             // index of the current counting period
+	counts map[string]uint32 // messages received in the current period, keyed by the sender's public key
+}
+
+// newSenderQuota creates a quota allowing limit messages per sender and period.
+func newSenderQuota(limit uint32) *senderQuota {
+	return &senderQuota{
+		limit:  limit,
+		counts: make(map[string]uint32),
+	}
+}
+
+// allow counts a message of the given sender at the given time, and reports
+// whether the sender is still within its quota. Unsigned messages have no
+// identity to account them to, and are always allowed.
+func (q *senderQuota) allow(src *ecdsa.PublicKey, now time.Time) bool {
+	if q == nil || src == nil {
+		return true
+	}
+	key := string(crypto.FromECDSAPub(src))
+	period := now.UnixNano() / int64(senderQuotaPeriod)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// the counters are dropped at the end of every period, which
+	// bounds the memory to the number of senders seen within one
+	if period != q.period {
+		q.period = period
+		q.counts = make(map[string]uint32)
+	}
+	if q.counts[key] >= q.limit {
+		return false
+	}
+	q.counts[key]++
+	return true
+}
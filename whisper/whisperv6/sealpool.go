@@ -0,0 +1,123 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package whisperv6
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	sealRatePeriod     = time.Minute // period over which the sealing requests are counted
+	defaultSealMaxTime = 10          // default maximum proof of work time of a job, in seconds
+)
+
+var (
+	errSealingDisabled = errors.New("envelope sealing service is disabled")
+	errSealRateLimit   = errors.New("envelope sealing rate limit exceeded")
+	errSealPowTarget   = errors.New("envelope sealing requires a positive PoW target")
+)
+
+// sealPool performs the proof of work of envelopes on behalf of constrained
+// clients, which can't afford sealing them on their own (e.g. mobile or light
+// nodes). The jobs are processed one at a time, each of them spread over all
+// the workers of the pool, and for at most maxTime seconds.
+type sealPool struct {
+	workers int    // number of concurrent workers per job
+	maxSize int    // maximum size of the envelopes to seal
+	maxTime uint32 // maximum proof of work time of a job, in seconds
+	rate    uint32 // maximum number of jobs per caller and period, 0 if unlimited
+
+	slot chan struct{} // token held by the job currently sealed
+
+	mu     sync.Mutex
+	period int64                  // index of the current counting period
+	counts map[interface{}]uint32 // jobs accepted from each caller in the current period
+}
+
+// newSealPool creates a pool with the given parallelism and limits.
+func newSealPool(workers uint32, maxSize uint32, maxTime uint32, rate uint32) *sealPool {
+	return &sealPool{
+		workers: int(workers),
+		maxSize: int(maxSize),
+		maxTime: maxTime,
+		rate:    rate,
+		slot:    make(chan struct{}, 1),
+		counts:  make(map[interface{}]uint32),
+	}
+}
+
+// allow counts a job of the caller at the given time, and reports whether the
+// caller is still within its rate limit.
+func (p *sealPool) allow(caller interface{}, now time.Time) bool {
+	if p.rate == 0 {
+		return true
+	}
+	period := now.UnixNano() / int64(sealRatePeriod)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if period != p.period {
+		p.period, p.counts = period, make(map[interface{}]uint32)
+	}
+	if p.counts[caller] >= p.rate {
+		return false
+	}
+	p.counts[caller]++
+	return true
+}
+
+// seal performs the proof of work of the envelope, waiting for the pool to
+// become available if it is busy with another job.
+func (p *sealPool) seal(ctx context.Context, caller interface{}, env *Envelope, options *MessageParams) error {
+	if p == nil {
+		return errSealingDisabled
+	}
+	if env.size() > p.maxSize {
+		return fmt.Errorf("envelope too large to seal: %d bytes, limit %d", env.size(), p.maxSize)
+	}
+	if options.WorkTime > p.maxTime {
+		return fmt.Errorf("PoW time too long: %d seconds, limit %d", options.WorkTime, p.maxTime)
+	}
+	// without a target the job would run for the whole PoW time
+	if options.PoW <= 0 {
+		return errSealPowTarget
+	}
+	if !p.allow(caller, time.Now()) {
+		return errSealRateLimit
+	}
+
+	select {
+	case p.slot <- struct{}{}:
+		defer func() { <-p.slot }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return env.SealParallel(ctx, options, p.workers)
+}
+
+// SealEnvelope performs the proof of work of the envelope using the node's
+// sealing pool, subject to its size, time and rate limits. The caller identifies
+// the client on whose behalf the envelope is sealed, the rate limit applies to
+// each caller separately.
+func (whisper *Whisper) SealEnvelope(ctx context.Context, caller interface{}, env *Envelope, options *MessageParams) error {
+	return whisper.sealPool.seal(ctx, caller, env, options)
+}
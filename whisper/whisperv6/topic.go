@@ -55,3 +55,17 @@ func (t TopicType) MarshalText() ([]byte, error) {
 func (t *TopicType) UnmarshalText(input []byte) error {
 	return hexutil.UnmarshalFixedText("Topic", input, t[:])
 }
+
+// TopicPoW is the minimal PoW required by a node for the envelopes on a
+// specific topic, overriding the node's general minimum.
+type TopicPoW struct {
+	Topic TopicType
+	PoW   float64
+}
+
+// topicPowRequirement is the wire representation of TopicPoW, exchanged in
+// the status handshake and in topicPowCode messages.
+type topicPowRequirement struct {
+	Topic TopicType
+	PoW   uint64 // IEEE 754 bits of the float64 value
+}
@@ -18,9 +18,11 @@ package whisperv6
 
 import (
 	"bytes"
+	"container/heap"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"fmt"
+	"hash/fnv"
 	"math"
 	"runtime"
 	"sync"
@@ -29,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -46,6 +49,7 @@ type Statistics struct {
 	memoryUsed           int
 	cycles               int
 	totalMessagesCleared int
+	evictions            int // envelopes evicted before expiry to keep the cache within its size
 }
 
 const (
@@ -55,6 +59,9 @@ const (
 	minPowToleranceIdx             // Minimal PoW tolerated by the whisper node for a limited time
 	bloomFilterIdx                 // Bloom filter for topics of interest for this node
 	bloomFilterToleranceIdx        // Bloom filter tolerated by the whisper node for a limited time
+	forwardingPolicyIdx            // Policy deciding which envelopes are relayed to which peers
+	topicPowIdx                    // Minimal PoW required by the whisper node for specific topics
+	topicPowToleranceIdx           // Minimal PoW for specific topics tolerated by the whisper node for a limited time
 )
 
 // Whisper represents a dark communication interface through the Ethereum
@@ -66,19 +73,33 @@ type Whisper struct {
 	privateKeys map[string]*ecdsa.PrivateKey // Private key storage
 	symKeys     map[string][]byte            // Symmetric key storage
 	keyMu       sync.RWMutex                 // Mutex associated with key storages
+	identities  *identityStore               // Persistent store of the key pairs, nil if not configured
 
 	poolMu      sync.RWMutex              // Mutex to sync the message and expiration pools
 	envelopes   map[common.Hash]*Envelope // Pool of envelopes currently tracked by this node
 	expirations map[uint32]*set.SetNonTS  // Message expiration pool
+	expiryIndex expiryHeap                // Expiry times present in the expiration pool, ordered
+
+	cacheSize      int    // Maximum total size of the cached envelopes
+	cacheRetention uint32 // Maximum time in seconds an envelope is cached, 0 if bounded only by its TTL
+
+	rebroadcastInterval time.Duration // Average interval of the re-broadcast rounds to new peers, 0 if disabled
 
 	peerMu sync.RWMutex       // Mutex to sync the active peer set
 	peers  map[*Peer]struct{} // Set of currently active peers
 
-	messageQueue chan *Envelope // Message queue for normal whisper messages
-	p2pMsgQueue  chan *Envelope // Message queue for peer-to-peer messages (not to be forwarded any further)
-	quit         chan struct{}  // Channel used for graceful exit
+	messageQueues    []chan *Envelope // Message queues for normal whisper messages, sharded by topic
+	queueDepths      []metrics.Gauge  // Number of messages waiting in each of the message queues
+	priorityMsgQueue chan *Envelope   // Message queue for messages on priority topics
+	p2pMsgQueue      chan *Envelope   // Message queue for peer-to-peer messages (not to be forwarded any further)
+	quit             chan struct{}    // Channel used for graceful exit
+
+	priorityTopics map[TopicType]struct{} // Topics whose messages bypass the normal message queue
+	senderQuota    *senderQuota           // Limit of messages delivered from a single sender, nil if unlimited
+	sealPool       *sealPool              // Workers sealing envelopes on behalf of clients, nil if disabled
 
-	settings syncmap.Map // holds configuration settings that can be dynamically changed
+	settings   syncmap.Map // holds configuration settings that can be dynamically changed
+	topicPowMu sync.Mutex  // Mutex serializing the updates of the per-topic PoW requirements
 
 	syncAllowance int // maximum time in seconds allowed to process the whisper-related messages
 
@@ -87,6 +108,8 @@ type Whisper struct {
 	statsMu sync.Mutex // guard stats
 	stats   Statistics // Statistics of whisper node
 
+	drops dropCounter // Envelopes dropped per reason over a rolling window
+
 	mailServer MailServer // MailServer interface
 }
 
@@ -97,15 +120,53 @@ func New(cfg *Config) *Whisper {
 	}
 
 	whisper := &Whisper{
-		privateKeys:   make(map[string]*ecdsa.PrivateKey),
-		symKeys:       make(map[string][]byte),
-		envelopes:     make(map[common.Hash]*Envelope),
-		expirations:   make(map[uint32]*set.SetNonTS),
-		peers:         make(map[*Peer]struct{}),
-		messageQueue:  make(chan *Envelope, messageQueueLimit),
-		p2pMsgQueue:   make(chan *Envelope, messageQueueLimit),
-		quit:          make(chan struct{}),
-		syncAllowance: DefaultSyncAllowance,
+		privateKeys:      make(map[string]*ecdsa.PrivateKey),
+		symKeys:          make(map[string][]byte),
+		envelopes:        make(map[common.Hash]*Envelope),
+		expirations:      make(map[uint32]*set.SetNonTS),
+		peers:            make(map[*Peer]struct{}),
+		priorityMsgQueue: make(chan *Envelope, priorityQueueLimit),
+		p2pMsgQueue:      make(chan *Envelope, messageQueueLimit),
+		quit:             make(chan struct{}),
+		priorityTopics:   make(map[TopicType]struct{}),
+		syncAllowance:    DefaultSyncAllowance,
+		cacheSize:        int(cfg.EnvelopeCacheSize),
+		cacheRetention:   cfg.EnvelopeCacheRetention,
+
+		rebroadcastInterval: time.Duration(cfg.RebroadcastInterval) * time.Second,
+	}
+	for _, topic := range cfg.PriorityTopics {
+		whisper.priorityTopics[topic] = struct{}{}
+	}
+	if cfg.SenderQuota > 0 {
+		whisper.senderQuota = newSenderQuota(cfg.SenderQuota)
+	}
+	shards := int(cfg.QueueShards)
+	if shards == 0 {
+		shards = runtime.NumCPU()
+	}
+	whisper.messageQueues = make([]chan *Envelope, shards)
+	whisper.queueDepths = make([]metrics.Gauge, shards)
+	for i := range whisper.messageQueues {
+		whisper.messageQueues[i] = make(chan *Envelope, messageQueueLimit)
+		whisper.queueDepths[i] = metrics.GetOrRegisterGauge(fmt.Sprintf("whisper/queue/shard/%d", i), nil)
+	}
+	if cfg.SealWorkers > 0 {
+		maxSize := cfg.SealMaxSize
+		if maxSize == 0 {
+			maxSize = cfg.MaxMessageSize
+		}
+		if maxSize == 0 {
+			maxSize = DefaultMaxMessageSize
+		}
+		maxTime := cfg.SealMaxTime
+		if maxTime == 0 {
+			maxTime = defaultSealMaxTime
+		}
+		whisper.sealPool = newSealPool(cfg.SealWorkers, maxSize, maxTime, cfg.SealRate)
+	}
+	if whisper.cacheSize == 0 {
+		whisper.cacheSize = int(DefaultEnvelopeCacheSize)
 	}
 
 	whisper.filters = NewFilters(whisper)
@@ -114,6 +175,13 @@ func New(cfg *Config) *Whisper {
 	whisper.settings.Store(maxMsgSizeIdx, cfg.MaxMessageSize)
 	whisper.settings.Store(overflowIdx, false)
 
+	topicPow := make(map[TopicType]float64)
+	for _, req := range cfg.TopicPoW {
+		topicPow[req.Topic] = req.PoW
+	}
+	whisper.settings.Store(topicPowIdx, topicPow)
+	whisper.settings.Store(topicPowToleranceIdx, topicPow)
+
 	// p2p whisper sub protocol handler
 	whisper.protocol = p2p.Protocol{
 		Name:    ProtocolName,
@@ -157,6 +225,34 @@ func (whisper *Whisper) MinPowTolerance() float64 {
 	return val.(float64)
 }
 
+// MinPowForTopic returns the PoW required by this node for envelopes on the
+// given topic, which is MinPow unless it was overridden for the topic.
+func (whisper *Whisper) MinPowForTopic(topic TopicType) float64 {
+	if pow, ok := whisper.topicPow(topicPowIdx)[topic]; ok {
+		return pow
+	}
+	return whisper.MinPow()
+}
+
+// minPowToleranceForTopic returns the value of minimum PoW for the topic, which
+// is tolerated for a limited time after the requirement was changed.
+func (whisper *Whisper) minPowToleranceForTopic(topic TopicType) float64 {
+	if pow, ok := whisper.topicPow(topicPowToleranceIdx)[topic]; ok {
+		return pow
+	}
+	return whisper.MinPowTolerance()
+}
+
+// topicPow loads the per-topic PoW requirements stored under the given index.
+// The returned map must not be modified.
+func (whisper *Whisper) topicPow(idx int) map[TopicType]float64 {
+	val, exist := whisper.settings.Load(idx)
+	if !exist || val == nil {
+		return nil
+	}
+	return val.(map[TopicType]float64)
+}
+
 // BloomFilter returns the aggregated bloom filter for all the topics of interest.
 // The nodes are required to send only messages that match the advertised bloom filter.
 // If a message does not match the bloom, it will tantamount to spam, and the peer will
@@ -181,6 +277,63 @@ func (whisper *Whisper) BloomFilterTolerance() []byte {
 	return val.([]byte)
 }
 
+// ForwardingPolicy returns the policy deciding which envelopes are relayed.
+func (whisper *Whisper) ForwardingPolicy() ForwardingPolicy {
+	val, exist := whisper.settings.Load(forwardingPolicyIdx)
+	if !exist || val == nil {
+		return DefaultForwardingPolicy
+	}
+	return val.(ForwardingPolicy)
+}
+
+// SetForwardingPolicy replaces the policy deciding which envelopes are relayed
+// to the peers. A nil policy restores the default one.
+func (whisper *Whisper) SetForwardingPolicy(policy ForwardingPolicy) {
+	if policy == nil {
+		policy = DefaultForwardingPolicy
+	}
+	whisper.settings.Store(forwardingPolicyIdx, policy)
+}
+
+// queuePressure returns the fill ratio of the most loaded message queue.
+func (whisper *Whisper) queuePressure() float64 {
+	var pressure float64
+	for _, queue := range whisper.messageQueues {
+		if p := float64(len(queue)) / float64(messageQueueLimit); p > pressure {
+			pressure = p
+		}
+	}
+	return pressure
+}
+
+// queuedMessages returns the number of normal messages waiting to be processed.
+func (whisper *Whisper) queuedMessages() int {
+	var n int
+	for _, queue := range whisper.messageQueues {
+		n += len(queue)
+	}
+	return n
+}
+
+// QueueDepths returns the number of messages waiting in each of the message
+// queue shards.
+func (whisper *Whisper) QueueDepths() []int {
+	depths := make([]int, len(whisper.messageQueues))
+	for i, queue := range whisper.messageQueues {
+		depths[i] = len(queue)
+	}
+	return depths
+}
+
+// queueShard returns the index of the message queue serving the given topic.
+// The topic is hashed, so that topics differing in any of their bytes are
+// spread over the shards.
+func (whisper *Whisper) queueShard(topic TopicType) int {
+	h := fnv.New32a()
+	h.Write(topic[:])
+	return int(h.Sum32() % uint32(len(whisper.messageQueues)))
+}
+
 // MaxMessageSize returns the maximum accepted message size.
 func (whisper *Whisper) MaxMessageSize() uint32 {
 	val, _ := whisper.settings.Load(maxMsgSizeIdx)
@@ -202,6 +355,12 @@ func (whisper *Whisper) APIs() []rpc.API {
 			Service:   NewPublicWhisperAPI(whisper),
 			Public:    true,
 		},
+		{
+			Namespace: KeystoreNamespace,
+			Version:   ProtocolVersionStr,
+			Service:   NewPrivateKeystoreAPI(whisper),
+			Public:    false,
+		},
 	}
 }
 
@@ -269,6 +428,48 @@ func (whisper *Whisper) SetMinimumPoW(val float64) error {
 	return nil
 }
 
+// SetTopicPoW sets the minimal PoW required by this node for a specific topic,
+// overriding the general minimum, and notifies the peers.
+func (whisper *Whisper) SetTopicPoW(topic TopicType, val float64) error {
+	if val < 0.0 {
+		return fmt.Errorf("invalid PoW: %f", val)
+	}
+	whisper.updateTopicPow(func(reqs map[TopicType]float64) {
+		reqs[topic] = val
+	})
+	return nil
+}
+
+// RemoveTopicPoW removes the PoW override of a specific topic, so that the
+// general minimum applies again, and notifies the peers.
+func (whisper *Whisper) RemoveTopicPoW(topic TopicType) {
+	whisper.updateTopicPow(func(reqs map[TopicType]float64) {
+		delete(reqs, topic)
+	})
+}
+
+// updateTopicPow applies the update to a copy of the per-topic PoW requirements,
+// stores the result and notifies the peers about it.
+func (whisper *Whisper) updateTopicPow(update func(map[TopicType]float64)) {
+	whisper.topicPowMu.Lock()
+	defer whisper.topicPowMu.Unlock()
+
+	reqs := make(map[TopicType]float64)
+	for topic, pow := range whisper.topicPow(topicPowIdx) {
+		reqs[topic] = pow
+	}
+	update(reqs)
+
+	whisper.settings.Store(topicPowIdx, reqs)
+	whisper.notifyPeersAboutTopicPowChange(encodeTopicPow(reqs))
+
+	go func() {
+		// allow some time before all the peers have processed the notification
+		time.Sleep(time.Duration(whisper.syncAllowance) * time.Second)
+		whisper.settings.Store(topicPowToleranceIdx, reqs)
+	}()
+}
+
 // SetMinimumPowTest sets the minimal PoW in test environment
 func (whisper *Whisper) SetMinimumPowTest(val float64) {
 	whisper.settings.Store(minPowIdx, val)
@@ -304,6 +505,42 @@ func (whisper *Whisper) notifyPeersAboutBloomFilterChange(bloom []byte) {
 	}
 }
 
+func (whisper *Whisper) notifyPeersAboutTopicPowChange(reqs []topicPowRequirement) {
+	arr := whisper.getPeers()
+	for _, p := range arr {
+		err := p.notifyAboutTopicPowChange(reqs)
+		if err != nil {
+			// allow one retry
+			err = p.notifyAboutTopicPowChange(reqs)
+		}
+		if err != nil {
+			log.Warn("failed to notify peer about new topic pow requirements", "peer", p.ID(), "error", err)
+		}
+	}
+}
+
+// encodeTopicPow converts the per-topic PoW requirements to their wire representation.
+func encodeTopicPow(reqs map[TopicType]float64) []topicPowRequirement {
+	res := make([]topicPowRequirement, 0, len(reqs))
+	for topic, pow := range reqs {
+		res = append(res, topicPowRequirement{Topic: topic, PoW: math.Float64bits(pow)})
+	}
+	return res
+}
+
+// decodeTopicPow converts the per-topic PoW requirements received from a peer.
+func decodeTopicPow(reqs []topicPowRequirement) (map[TopicType]float64, error) {
+	res := make(map[TopicType]float64, len(reqs))
+	for _, req := range reqs {
+		pow := math.Float64frombits(req.PoW)
+		if math.IsInf(pow, 0) || math.IsNaN(pow) || pow < 0.0 {
+			return nil, fmt.Errorf("invalid pow for topic %x", req.Topic)
+		}
+		res[req.Topic] = pow
+	}
+	return res, nil
+}
+
 func (whisper *Whisper) getPeers() []*Peer {
 	arr := make([]*Peer, len(whisper.peers))
 	i := 0
@@ -498,12 +735,7 @@ func (whisper *Whisper) AddSymKeyFromPassword(password string) (string, error) {
 		return "", fmt.Errorf("failed to generate unique ID")
 	}
 
-	// kdf should run no less than 0.1 seconds on an average computer,
-	// because it's an once in a session experience
-	derived := pbkdf2.Key([]byte(password), nil, 65356, aesKeyLength, sha256.New)
-	if err != nil {
-		return "", err
-	}
+	derived := deriveKeyFromPassword(password)
 
 	whisper.keyMu.Lock()
 	defer whisper.keyMu.Unlock()
@@ -516,6 +748,13 @@ func (whisper *Whisper) AddSymKeyFromPassword(password string) (string, error) {
 	return id, nil
 }
 
+// deriveKeyFromPassword derives a symmetric key from the password.
+func deriveKeyFromPassword(password string) []byte {
+	// kdf should run no less than 0.1 seconds on an average computer,
+	// because it's an once in a session experience
+	return pbkdf2.Key([]byte(password), nil, 65356, aesKeyLength, sha256.New)
+}
+
 // HasSymKey returns true if there is a key associated with the given id.
 // Otherwise returns false.
 func (whisper *Whisper) HasSymKey(id string) bool {
@@ -602,9 +841,8 @@ func (whisper *Whisper) Start(*p2p.Server) error {
 	log.Info("started whisper v." + ProtocolVersionStr)
 	go whisper.update()
 
-	numCPU := runtime.NumCPU()
-	for i := 0; i < numCPU; i++ {
-		go whisper.processQueue()
+	for i := range whisper.messageQueues {
+		go whisper.processQueue(i)
 	}
 
 	return nil
@@ -654,6 +892,7 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 			return err
 		}
 		if packet.Size > whisper.MaxMessageSize() {
+			whisper.drops.inc(dropOversize, time.Now())
 			log.Warn("oversized message received", "peer", p.peer.ID())
 			return errors.New("oversized message received")
 		}
@@ -672,6 +911,7 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 
 			trouble := false
 			for _, env := range envelopes {
+				env.source = p.ID()
 				cached, err := whisper.add(env, whisper.lightClient)
 				if err != nil {
 					trouble = true
@@ -679,6 +919,8 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 				}
 				if cached {
 					p.mark(env)
+					// the peer evidently has the envelope, no need to re-offer it
+					p.forwarded.Remove(env.Hash())
 				}
 			}
 
@@ -710,6 +952,19 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 				return errors.New("invalid bloom filter exchange message")
 			}
 			p.setBloomFilter(bloom)
+		case topicPowCode:
+			var reqs []topicPowRequirement
+			err := packet.Decode(&reqs)
+			if err != nil {
+				log.Warn("failed to decode topic pow message, peer will be disconnected", "peer", p.peer.ID(), "err", err)
+				return errors.New("invalid topic pow message")
+			}
+			topicPow, err := decodeTopicPow(reqs)
+			if err != nil {
+				log.Warn("invalid value in topic pow message, peer will be disconnected", "peer", p.peer.ID(), "err", err)
+				return errors.New("invalid value in topic pow message")
+			}
+			p.setTopicPowRequirements(topicPow)
 		case p2pMessageCode:
 			// peer-to-peer message, sent directly to peer bypassing PoW checks, etc.
 			// this message is not supposed to be forwarded to other peers, and
@@ -759,6 +1014,7 @@ func (whisper *Whisper) add(envelope *Envelope, isP2P bool) (bool, error) {
 	}
 
 	if envelope.Expiry < now {
+		whisper.drops.inc(dropExpired, time.Now())
 		if envelope.Expiry+DefaultSyncAllowance*2 < now {
 			return false, fmt.Errorf("very old message")
 		}
@@ -767,14 +1023,16 @@ func (whisper *Whisper) add(envelope *Envelope, isP2P bool) (bool, error) {
 	}
 
 	if uint32(envelope.size()) > whisper.MaxMessageSize() {
+		whisper.drops.inc(dropOversize, time.Now())
 		return false, fmt.Errorf("huge messages are not allowed [%x]", envelope.Hash())
 	}
 
-	if envelope.PoW() < whisper.MinPow() {
+	if envelope.PoW() < whisper.MinPowForTopic(envelope.Topic) {
 		// maybe the value was recently changed, and the peers did not adjust yet.
-		// in this case the previous value is retrieved by MinPowTolerance()
+		// in this case the previous value is retrieved by minPowToleranceForTopic()
 		// for a short period of peer synchronization.
-		if envelope.PoW() < whisper.MinPowTolerance() {
+		if envelope.PoW() < whisper.minPowToleranceForTopic(envelope.Topic) {
+			whisper.drops.inc(dropLowPoW, time.Now())
 			return false, fmt.Errorf("envelope with low PoW received: PoW=%f, hash=[%v]", envelope.PoW(), envelope.Hash().Hex())
 		}
 	}
@@ -784,6 +1042,7 @@ func (whisper *Whisper) add(envelope *Envelope, isP2P bool) (bool, error) {
 		// in this case the previous value is retrieved by BloomFilterTolerance()
 		// for a short period of peer synchronization.
 		if !BloomFilterMatch(whisper.BloomFilterTolerance(), envelope.Bloom()) {
+			whisper.drops.inc(dropBloomMismatch, time.Now())
 			return false, fmt.Errorf("envelope does not match bloom filter, hash=[%v], bloom: \n%x \n%x \n%x",
 				envelope.Hash().Hex(), whisper.BloomFilter(), envelope.Bloom(), envelope.Topic)
 		}
@@ -791,15 +1050,23 @@ func (whisper *Whisper) add(envelope *Envelope, isP2P bool) (bool, error) {
 
 	hash := envelope.Hash()
 
+	// envelopes are kept until they expire, unless the retention is capped
+	expiry := envelope.Expiry
+	if whisper.cacheRetention > 0 && expiry > now+whisper.cacheRetention {
+		expiry = now + whisper.cacheRetention
+	}
+
 	whisper.poolMu.Lock()
 	_, alreadyCached := whisper.envelopes[hash]
 	if !alreadyCached {
+		whisper.makeRoom(envelope.size())
 		whisper.envelopes[hash] = envelope
-		if whisper.expirations[envelope.Expiry] == nil {
-			whisper.expirations[envelope.Expiry] = set.NewNonTS()
+		if whisper.expirations[expiry] == nil {
+			whisper.expirations[expiry] = set.NewNonTS()
+			heap.Push(&whisper.expiryIndex, expiry)
 		}
-		if !whisper.expirations[envelope.Expiry].Has(hash) {
-			whisper.expirations[envelope.Expiry].Add(hash)
+		if !whisper.expirations[expiry].Has(hash) {
+			whisper.expirations[expiry].Add(hash)
 		}
 	}
 	whisper.poolMu.Unlock()
@@ -808,9 +1075,6 @@ func (whisper *Whisper) add(envelope *Envelope, isP2P bool) (bool, error) {
 		log.Trace("whisper envelope already cached", "hash", envelope.Hash().Hex())
 	} else {
 		log.Trace("cached whisper envelope", "hash", envelope.Hash().Hex())
-		whisper.statsMu.Lock()
-		whisper.stats.memoryUsed += envelope.size()
-		whisper.statsMu.Unlock()
 		whisper.postEvent(envelope, isP2P) // notify the local node about the new message
 		if whisper.mailServer != nil {
 			whisper.mailServer.Archive(envelope)
@@ -819,19 +1083,83 @@ func (whisper *Whisper) add(envelope *Envelope, isP2P bool) (bool, error) {
 	return true, nil
 }
 
+// makeRoom evicts the envelopes which are closest to their expiration, until
+// an envelope of the given size fits into the cache, and accounts the memory
+// used by the new envelope. This bounds the memory used by the pool in case of
+// flooding. The caller must hold poolMu.
+func (whisper *Whisper) makeRoom(size int) {
+	whisper.statsMu.Lock()
+	defer whisper.statsMu.Unlock()
+
+	for whisper.stats.memoryUsed+size > whisper.cacheSize && len(whisper.expiryIndex) > 0 {
+		oldest := whisper.expiryIndex[0]
+		hashSet := whisper.expirations[oldest]
+		if hash, ok := hashSet.Pop().(common.Hash); ok {
+			sz := whisper.envelopes[hash].size()
+			delete(whisper.envelopes, hash)
+			whisper.stats.memoryUsed -= sz
+			whisper.stats.evictions++
+		}
+		if hashSet.IsEmpty() {
+			delete(whisper.expirations, oldest)
+			heap.Pop(&whisper.expiryIndex)
+		}
+	}
+	whisper.stats.memoryUsed += size
+}
+
+// expiryHeap is a min-heap of expiry times, implementing heap.Interface.
+type expiryHeap []uint32
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(uint32)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
 // postEvent queues the message for further processing.
 func (whisper *Whisper) postEvent(envelope *Envelope, isP2P bool) {
 	if isP2P {
 		whisper.p2pMsgQueue <- envelope
+	} else if whisper.isPriority(envelope) {
+		whisper.checkOverflow()
+		// the priority topics are not authenticated, so the priority queue
+		// is not waited for either, or any peer could stall the others
+		select {
+		case whisper.priorityMsgQueue <- envelope:
+		default:
+			messageDropQueueFullMeter.Mark(1)
+			log.Trace("priority message queue full, message dropped", "hash", envelope.Hash().Hex())
+		}
 	} else {
+		shard := whisper.queueShard(envelope.Topic)
 		whisper.checkOverflow()
-		whisper.messageQueue <- envelope
+		// a full shard is not waited for, so that a single busy topic
+		// does not stall the peers delivering the other topics
+		select {
+		case whisper.messageQueues[shard] <- envelope:
+			whisper.queueDepths[shard].Update(int64(len(whisper.messageQueues[shard])))
+		default:
+			messageDropQueueFullMeter.Mark(1)
+			log.Trace("message queue shard full, message dropped", "shard", shard, "hash", envelope.Hash().Hex())
+		}
 	}
 }
 
 // checkOverflow checks if message queue overflow occurs and reports it if necessary.
+// The average load of the queue shards, rather than that of the busiest one, and
+// the load of the priority queue are considered, the latter scaled to the size
+// of a shard. The messages of a full shard are dropped, see postEvent.
 func (whisper *Whisper) checkOverflow() {
-	queueSize := len(whisper.messageQueue)
+	queueSize := whisper.queuedMessages() / len(whisper.messageQueues)
+	if size := len(whisper.priorityMsgQueue) * messageQueueLimit / priorityQueueLimit; size > queueSize {
+		queueSize = size
+	}
 
 	if queueSize == messageQueueLimit {
 		if !whisper.Overflow() {
@@ -846,21 +1174,70 @@ func (whisper *Whisper) checkOverflow() {
 	}
 }
 
-// processQueue delivers the messages to the watchers during the lifetime of the whisper node.
-func (whisper *Whisper) processQueue() {
-	var e *Envelope
+// isPriority checks if the envelope belongs to one of the priority topics.
+func (whisper *Whisper) isPriority(envelope *Envelope) bool {
+	_, ok := whisper.priorityTopics[envelope.Topic]
+	return ok
+}
+
+// processQueue delivers the messages of a message queue shard to the watchers
+// during the lifetime of the whisper node. The priority and peer-to-peer
+// messages are shared among all the shard workers.
+func (whisper *Whisper) processQueue(shard int) {
+	var served int
 	for {
-		select {
-		case <-whisper.quit:
+		e, isP2P, ok := whisper.dequeue(shard, &served)
+		if !ok {
 			return
+		}
+		whisper.filters.NotifyWatchers(e, isP2P)
+	}
+}
 
-		case e = <-whisper.messageQueue:
-			whisper.filters.NotifyWatchers(e, false)
-
+// dequeue blocks until the next message for the given shard worker is available,
+// or the node is stopped. The priority lane is served first, so that its messages
+// are never stuck behind the bulk of the traffic, but after priorityWeight of them
+// in a row the other queues get their turn, so that a flood of priority messages
+// can't starve them. served counts the priority messages served in a row.
+func (whisper *Whisper) dequeue(shard int, served *int) (e *Envelope, isP2P bool, ok bool) {
+	queue := whisper.messageQueues[shard]
+	if *served < priorityWeight {
+		select {
+		case e = <-whisper.priorityMsgQueue:
+			*served++
+			return e, false, true
+		default:
+		}
+	} else {
+		// give the other queues a turn, if they have anything to serve
+		select {
+		case e = <-queue:
+			whisper.queueDepths[shard].Update(int64(len(queue)))
+			*served = 0
+			return e, false, true
 		case e = <-whisper.p2pMsgQueue:
-			whisper.filters.NotifyWatchers(e, true)
+			*served = 0
+			return e, true, true
+		default:
 		}
 	}
+	*served = 0
+
+	select {
+	case <-whisper.quit:
+		return nil, false, false
+
+	case e = <-whisper.priorityMsgQueue:
+		*served++
+		return e, false, true
+
+	case e = <-queue:
+		whisper.queueDepths[shard].Update(int64(len(queue)))
+		return e, false, true
+
+	case e = <-whisper.p2pMsgQueue:
+		return e, true, true
+	}
 }
 
 // update loops until the lifetime of the whisper node, updating its internal
@@ -891,20 +1268,21 @@ func (whisper *Whisper) expire() {
 	defer whisper.statsMu.Unlock()
 	whisper.stats.reset()
 	now := uint32(time.Now().Unix())
-	for expiry, hashSet := range whisper.expirations {
-		if expiry < now {
-			// Dump all expired messages and remove timestamp
-			hashSet.Each(func(v interface{}) bool {
-				sz := whisper.envelopes[v.(common.Hash)].size()
-				delete(whisper.envelopes, v.(common.Hash))
-				whisper.stats.messagesCleared++
-				whisper.stats.memoryCleared += sz
-				whisper.stats.memoryUsed -= sz
-				return true
-			})
-			whisper.expirations[expiry].Clear()
-			delete(whisper.expirations, expiry)
-		}
+	for len(whisper.expiryIndex) > 0 && whisper.expiryIndex[0] < now {
+		expiry := heap.Pop(&whisper.expiryIndex).(uint32)
+		hashSet := whisper.expirations[expiry]
+
+		// Dump all expired messages and remove timestamp
+		hashSet.Each(func(v interface{}) bool {
+			sz := whisper.envelopes[v.(common.Hash)].size()
+			delete(whisper.envelopes, v.(common.Hash))
+			whisper.stats.messagesCleared++
+			whisper.stats.memoryCleared += sz
+			whisper.stats.memoryUsed -= sz
+			return true
+		})
+		hashSet.Clear()
+		delete(whisper.expirations, expiry)
 	}
 }
 
@@ -916,6 +1294,12 @@ func (whisper *Whisper) Stats() Statistics {
 	return whisper.stats
 }
 
+// DroppedEnvelopes returns the number of incoming envelopes dropped for each
+// reason during the last dropWindow.
+func (whisper *Whisper) DroppedEnvelopes() [numDropReasons]uint64 {
+	return whisper.drops.counts(time.Now())
+}
+
 // Envelopes retrieves all the messages currently pooled by the node.
 func (whisper *Whisper) Envelopes() []*Envelope {
 	whisper.poolMu.RLock()
@@ -928,6 +1312,23 @@ func (whisper *Whisper) Envelopes() []*Envelope {
 	return all
 }
 
+// EnvelopeForwards returns the number of times the envelope with the given hash
+// was transmitted to the peers, and whether the envelope is still cached.
+func (whisper *Whisper) EnvelopeForwards(hash common.Hash) (uint32, bool) {
+	envelope := whisper.GetEnvelope(hash)
+	if envelope == nil {
+		return 0, false
+	}
+	return envelope.Forwards(), true
+}
+
+// CachedEnvelopes returns the number of envelopes currently pooled by the node.
+func (whisper *Whisper) CachedEnvelopes() int {
+	whisper.poolMu.RLock()
+	defer whisper.poolMu.RUnlock()
+	return len(whisper.envelopes)
+}
+
 // isEnvelopeCached checks if envelope with specific hash has already been received and cached.
 func (whisper *Whisper) isEnvelopeCached(hash common.Hash) bool {
 	whisper.poolMu.Lock()
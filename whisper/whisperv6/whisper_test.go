@@ -20,11 +20,15 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/sha256"
+	"io/ioutil"
 	mrand "math/rand"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"golang.org/x/crypto/pbkdf2"
 )
 
@@ -883,3 +887,318 @@ func TestBloom(t *testing.T) {
 		t.Fatalf("retireved wrong bloom filter")
 	}
 }
+
+func TestDropCounterWindow(t *testing.T) {
+	var c dropCounter
+	start := time.Unix(1500000000, 0)
+
+	c.inc(dropLowPoW, start)
+	c.inc(dropLowPoW, start.Add(dropBucketSpan))
+	c.inc(dropExpired, start.Add(2*dropBucketSpan))
+
+	counts := c.counts(start.Add(2 * dropBucketSpan))
+	if counts[dropLowPoW] != 2 || counts[dropExpired] != 1 || counts[dropOversize] != 0 {
+		t.Fatalf("unexpected counts within the window: %v", counts)
+	}
+
+	// the first bucket falls out of the window
+	counts = c.counts(start.Add(dropWindow))
+	if counts[dropLowPoW] != 1 || counts[dropExpired] != 1 {
+		t.Fatalf("unexpected counts after the first bucket expired: %v", counts)
+	}
+
+	// overwriting a stale bucket must reset its counters
+	c.inc(dropBloomMismatch, start.Add(dropWindow))
+	counts = c.counts(start.Add(dropWindow))
+	if counts[dropLowPoW] != 1 || counts[dropBloomMismatch] != 1 {
+		t.Fatalf("unexpected counts after reusing a bucket: %v", counts)
+	}
+}
+
+// newTestEnvelope wraps a message with a random 100 byte payload into an
+// envelope on the given topic, living for ttl seconds.
+func newTestEnvelope(t *testing.T, topic TopicType, ttl uint32) *Envelope {
+	params, err := generateMessageParams()
+	if err != nil {
+		t.Fatalf("failed generateMessageParams with seed %d: %s.", seed, err)
+	}
+	params.Topic = topic
+	params.TTL = ttl
+	params.Payload = make([]byte, 100)
+	mrand.Read(params.Payload)
+	msg, err := NewSentMessage(params)
+	if err != nil {
+		t.Fatalf("failed to create new message with seed %d: %s.", seed, err)
+	}
+	env, err := msg.Wrap(params)
+	if err != nil {
+		t.Fatalf("failed Wrap with seed %d: %s.", seed, err)
+	}
+	return env
+}
+
+// sendTestEnvelope creates a test envelope, see newTestEnvelope, and sends it
+// through the node.
+func sendTestEnvelope(t *testing.T, w *Whisper, topic TopicType, ttl uint32) *Envelope {
+	env := newTestEnvelope(t, topic, ttl)
+	if err := w.Send(env); err != nil {
+		t.Fatalf("failed to send envelope with seed %d: %s.", seed, err)
+	}
+	return env
+}
+
+func TestEnvelopeCacheEviction(t *testing.T) {
+	InitSingleTest()
+
+	var envelopes []*Envelope
+	for _, ttl := range []uint32{30, 10, 20} {
+		envelopes = append(envelopes, newTestEnvelope(t, TopicType{0x01, 0x02, 0x03, 0x04}, ttl))
+	}
+
+	w := New(&Config{
+		MaxMessageSize:    DefaultMaxMessageSize,
+		EnvelopeCacheSize: uint64(2 * envelopes[0].size()),
+	})
+	for _, env := range envelopes {
+		if err := w.Send(env); err != nil {
+			t.Fatalf("failed to send envelope with seed %d: %s.", seed, err)
+		}
+	}
+
+	if n := w.CachedEnvelopes(); n != 2 {
+		t.Fatalf("wrong number of cached envelopes: have %d, want 2", n)
+	}
+	if n := w.Stats().evictions; n != 1 {
+		t.Fatalf("wrong number of evictions: have %d, want 1", n)
+	}
+	if w.GetEnvelope(envelopes[1].Hash()) != nil {
+		t.Fatalf("the envelope closest to expiry was not evicted")
+	}
+	if w.GetEnvelope(envelopes[0].Hash()) == nil || w.GetEnvelope(envelopes[2].Hash()) == nil {
+		t.Fatalf("wrong envelope evicted")
+	}
+	if used := w.Stats().memoryUsed; used != envelopes[0].size()+envelopes[2].size() {
+		t.Fatalf("wrong memory usage: have %d, want %d", used, envelopes[0].size()+envelopes[2].size())
+	}
+	if len(w.expiryIndex) != len(w.expirations) || w.expiryIndex[0] != envelopes[2].Expiry {
+		t.Fatalf("expiry index out of sync: %v", w.expiryIndex)
+	}
+}
+
+func TestPriorityTopics(t *testing.T) {
+	InitSingleTest()
+
+	priority := TopicType{0x05, 0x06, 0x07, 0x08}
+
+	cfg := DefaultConfig
+	cfg.MinimumAcceptedPOW = 0
+	cfg.PriorityTopics = []TopicType{priority}
+	w := New(&cfg)
+
+	for _, topic := range []TopicType{priority, {0x01, 0x02, 0x03, 0x04}} {
+		sendTestEnvelope(t, w, topic, 10)
+	}
+
+	if n := len(w.priorityMsgQueue); n != 1 {
+		t.Fatalf("wrong number of priority messages queued: have %d, want 1", n)
+	}
+	if n := w.queuedMessages(); n != 1 {
+		t.Fatalf("wrong number of normal messages queued: have %d, want 1", n)
+	}
+
+	// a full priority queue drops further messages without blocking the caller
+	for len(w.priorityMsgQueue) < priorityQueueLimit {
+		w.priorityMsgQueue <- &Envelope{}
+	}
+	w.postEvent(&Envelope{Topic: priority}, false)
+	if n := len(w.priorityMsgQueue); n != priorityQueueLimit {
+		t.Fatalf("wrong number of messages in the full priority queue: %d", n)
+	}
+}
+
+func TestPriorityWeight(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.QueueShards = 1
+	w := New(&cfg)
+
+	for i := 0; i < 2*priorityWeight; i++ {
+		w.priorityMsgQueue <- &Envelope{Nonce: uint64(i)}
+	}
+	normal := &Envelope{}
+	w.messageQueues[0] <- normal
+
+	var served int
+	for i := 0; i <= priorityWeight; i++ {
+		e, _, ok := w.dequeue(0, &served)
+		if !ok {
+			t.Fatalf("dequeue aborted")
+		}
+		if e == normal {
+			return
+		}
+	}
+	t.Fatalf("normal message starved by the priority lane")
+}
+
+func TestSenderQuota(t *testing.T) {
+	q := newSenderQuota(2)
+	now := time.Unix(1500000000, 0)
+
+	key1, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed GenerateKey: %s.", err)
+	}
+	key2, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed GenerateKey: %s.", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if !q.allow(&key1.PublicKey, now) {
+			t.Fatalf("message %d rejected within the quota", i)
+		}
+	}
+	if q.allow(&key1.PublicKey, now) {
+		t.Fatalf("message accepted beyond the quota")
+	}
+	if !q.allow(&key2.PublicKey, now) {
+		t.Fatalf("message of another sender rejected")
+	}
+	if !q.allow(nil, now) {
+		t.Fatalf("unsigned message rejected")
+	}
+	if !q.allow(&key1.PublicKey, now.Add(senderQuotaPeriod)) {
+		t.Fatalf("quota not renewed in the next period")
+	}
+
+	var disabled *senderQuota
+	if !disabled.allow(&key1.PublicKey, now) {
+		t.Fatalf("message rejected without a quota")
+	}
+}
+
+func TestTopicPow(t *testing.T) {
+	w := New(&DefaultConfig)
+	w.syncAllowance = 0
+	topic := TopicType{0x01, 0x02, 0x03, 0x04}
+
+	if err := w.SetTopicPoW(topic, -1); err == nil {
+		t.Fatalf("negative pow accepted")
+	}
+	if err := w.SetTopicPoW(topic, 0.5); err != nil {
+		t.Fatalf("failed to set topic pow: %s", err)
+	}
+	if pow := w.MinPowForTopic(topic); pow != 0.5 {
+		t.Fatalf("wrong pow for the topic: have %f, want 0.5", pow)
+	}
+	if pow := w.MinPowForTopic(TopicType{}); pow != w.MinPow() {
+		t.Fatalf("wrong pow for other topics: have %f, want %f", pow, w.MinPow())
+	}
+
+	reqs, err := decodeTopicPow(encodeTopicPow(w.topicPow(topicPowIdx)))
+	if err != nil || len(reqs) != 1 || reqs[topic] != 0.5 {
+		t.Fatalf("topic pow encoding roundtrip failed: %v, %v", reqs, err)
+	}
+
+	w.RemoveTopicPoW(topic)
+	if pow := w.MinPowForTopic(topic); pow != w.MinPow() {
+		t.Fatalf("wrong pow after removing the override: have %f, want %f", pow, w.MinPow())
+	}
+}
+
+func TestIdentityStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whisper-identities")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := New(&DefaultConfig)
+	id, err := w.NewKeyPair()
+	if err != nil {
+		t.Fatalf("failed to generate new key pair: %s", err)
+	}
+	if err := w.PersistKeyPair(id, "secret"); err != errNoIdentityStore {
+		t.Fatalf("key pair persisted without an identity store: %v", err)
+	}
+	w.SetIdentityStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	if err := w.PersistKeyPair(id, "secret"); err != nil {
+		t.Fatalf("failed to persist key pair: %s", err)
+	}
+	key, _ := w.GetPrivateKey(id)
+
+	// a restarted node restores the identity under the same ID
+	restarted := New(&DefaultConfig)
+	restarted.SetIdentityStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	if ids, err := restarted.PersistedKeyPairs(); err != nil || len(ids) != 1 || ids[0] != id {
+		t.Fatalf("wrong persisted key pairs: %v, %v", ids, err)
+	}
+	if err := restarted.UnlockKeyPair(id, "wrong"); err == nil {
+		t.Fatalf("key pair unlocked with a wrong passphrase")
+	}
+	if err := restarted.UnlockKeyPair(id, "secret"); err != nil {
+		t.Fatalf("failed to unlock key pair: %s", err)
+	}
+	if unlocked, err := restarted.GetPrivateKey(id); err != nil || !bytes.Equal(crypto.FromECDSA(unlocked), crypto.FromECDSA(key)) {
+		t.Fatalf("unlocked key pair does not match the persisted one")
+	}
+
+	if err := restarted.UnlockKeyPair("../"+id, "secret"); err == nil {
+		t.Fatalf("key pair unlocked with an invalid id")
+	}
+	if err := restarted.DeletePersistedKeyPair(id, "wrong"); err == nil {
+		t.Fatalf("key pair deleted with a wrong passphrase")
+	}
+	if err := restarted.DeletePersistedKeyPair(id, "secret"); err != nil {
+		t.Fatalf("failed to delete persisted key pair: %s", err)
+	}
+	if ids, _ := restarted.PersistedKeyPairs(); len(ids) != 0 {
+		t.Fatalf("key pair still persisted after deletion: %v", ids)
+	}
+}
+
+func TestQueueSharding(t *testing.T) {
+	InitSingleTest()
+
+	cfg := DefaultConfig
+	cfg.MinimumAcceptedPOW = 0
+	cfg.QueueShards = 4
+	w := New(&cfg)
+
+	// topics differing in their first byte only are spread over the shards
+	shards := make(map[int]bool)
+	for i := 0; i < 16; i++ {
+		shards[w.queueShard(TopicType{byte(i)})] = true
+	}
+	if len(shards) < 2 {
+		t.Fatalf("topics not spread over the shards")
+	}
+
+	topics := []TopicType{{0x00, 0x00, 0x00, 0x01}, {0x00, 0x00, 0x00, 0x01}, {0x00, 0x00, 0x00, 0x02}}
+	for _, topic := range topics {
+		sendTestEnvelope(t, w, topic, DefaultTTL)
+	}
+
+	// the messages of a topic are served by a single shard
+	depths := w.QueueDepths()
+	busy := w.queueShard(topics[0])
+	if len(depths) != 4 || depths[busy] < 2 || w.queuedMessages() != 3 {
+		t.Fatalf("wrong queue depths: %v", depths)
+	}
+	if pressure := w.queuePressure(); pressure != float64(depths[busy])/float64(messageQueueLimit) {
+		t.Fatalf("wrong queue pressure: %f", pressure)
+	}
+
+	// a full shard drops further messages, without blocking the caller or
+	// raising the overflow of the whole node
+	for len(w.messageQueues[busy]) < messageQueueLimit {
+		w.messageQueues[busy] <- &Envelope{}
+	}
+	w.postEvent(&Envelope{Topic: topics[0]}, false)
+	if n := len(w.messageQueues[busy]); n != messageQueueLimit {
+		t.Fatalf("wrong number of messages in the full shard: %d", n)
+	}
+	if w.Overflow() {
+		t.Fatalf("overflow raised by a single full shard")
+	}
+}